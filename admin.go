@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	"nba-pick-and-play/pkg/rapid"
+	"nba-pick-and-play/pkg/response"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type (
+	pollPayload struct {
+		Dates []string `json:"dates" validate:"required,min=1"`
+	}
+
+	gameDayPayload struct {
+		Date string `json:"date" validate:"required"`
+	}
+
+	seasonPayload struct {
+		Season string `json:"season"`
+	}
+
+	seasonSettingsPayload struct {
+		Scoring    string `json:"scoring" validate:"required,oneof=standard confidence"`
+		UpsetBonus int64  `json:"upsetBonus" validate:"min=0"`
+		PickType   string `json:"pickType" validate:"omitempty,oneof=straight spread"`
+	}
+
+	oddsPayload struct {
+		Games map[int64]odds `json:"games" validate:"required,min=1"` // game id -> odds
+	}
+
+	bracketPayload struct {
+		Deadline time.Time       `json:"deadline" validate:"required"`
+		Series   []seriesPayload `json:"series" validate:"required,min=1,dive"`
+	}
+
+	seriesPayload struct {
+		ID      string    `json:"id" validate:"required"`
+		Round   int       `json:"round" validate:"min=1"`
+		BestOf  int       `json:"bestOf" validate:"min=0"` // defaults to 7
+		Teams   [2]int64  `json:"teams"`                   // first round only
+		Feeders [2]string `json:"feeders"`                 // every round after the first
+	}
+
+	seasonImportPayload struct {
+		From string `json:"from" validate:"required"`
+		To   string `json:"to" validate:"required"`
+	}
+
+	gameOverridePayload struct {
+		Status    string `json:"status" validate:"required,oneof=Scheduled Live Halftime Finished Postponed Canceled Cancelled"` // see gameStateFromStatus
+		HomeScore int64  `json:"homeScore" validate:"min=0"`
+		AwayScore int64  `json:"awayScore" validate:"min=0"`
+	}
+
+	pollSummary struct {
+		GamesUpdated map[string]int `json:"gamesUpdated"` // date -> number of games saved
+	}
+
+	gameDayReportSummary struct {
+		GameDayID string    `json:"gameDayId"`
+		Games     int       `json:"games"`
+		Deadline  time.Time `json:"deadline"`
+	}
+
+	evaluationSummary struct {
+		GameDayID      string `json:"gameDayId"`
+		PicksEvaluated int    `json:"picksEvaluated"`
+	}
+
+	resultsSummary struct {
+		GameDayID string   `json:"gameDayId"`
+		Users     int      `json:"users"`
+		Scores    []result `json:"scores"`
+	}
+
+	leaderboardSummary struct {
+		Season    string            `json:"season"`
+		Users     int               `json:"users"`
+		Standings []leaderboardUser `json:"standings"`
+	}
+
+	oddsSummary struct {
+		GameDayID string          `json:"gameDayId"`
+		Underdogs map[int64]int64 `json:"underdogs"` // game id -> underdog team id, 0 if neither team is
+	}
+
+	gameOverrideSummary struct {
+		Before game `json:"before"`
+		After  game `json:"after"`
+	}
+)
+
+func adminPollGames(w http.ResponseWriter, r *http.Request) {
+	var payload pollPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	if err := validateDates(payload.Dates...); err != nil {
+		response.ReturnError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	summary := pollSummary{
+		GamesUpdated: make(map[string]int),
+	}
+
+	playoffGameFinished := false
+	for _, date := range payload.Dates {
+		updated, finished, err := pollGameDay(date)
+
+		if errors.Is(err, rapid.ErrQuotaExceeded) {
+			response.ReturnError(w, http.StatusTooManyRequests, err.Error())
+			return
+		}
+
+		if err != nil {
+			log.Error(err.Error())
+			response.ReturnError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+
+		summary.GamesUpdated[date] = updated
+		playoffGameFinished = playoffGameFinished || finished
+	}
+
+	if playoffGameFinished {
+		if err := updateBracket(config.Config.Rapid.Season); err != nil {
+			log.Error(err.Error())
+			response.ReturnError(w, http.StatusInternalServerError, genericError)
+			return
+		}
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, summary)
+}
+
+func adminCreateGameDayReport(w http.ResponseWriter, r *http.Request) {
+	var payload gameDayPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	if err := validateDates(payload.Date); err != nil {
+		response.ReturnError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := createGameDayReport(payload.Date)
+
+	if err != nil {
+		if errors.Is(err, errNoMatches) {
+			response.ReturnError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, gameDayReportSummary{
+		GameDayID: report.ID,
+		Games:     len(report.Games),
+		Deadline:  report.Deadline,
+	})
+}
+
+func adminEvaluateGameDay(w http.ResponseWriter, r *http.Request) {
+	var payload gameDayPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	if err := validateDates(payload.Date); err != nil {
+		response.ReturnError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	evaluated, err := evaluateGameDayReport(payload.Date)
+
+	if err != nil {
+		if errors.Is(err, errGameDayNotFinal) {
+			response.ReturnError(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		if errors.Is(err, errNoMatches) {
+			response.ReturnError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, evaluationSummary{
+		GameDayID:      payload.Date,
+		PicksEvaluated: evaluated,
+	})
+}
+
+func adminCreateGameDayResults(w http.ResponseWriter, r *http.Request) {
+	var payload gameDayPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	if err := validateDates(payload.Date); err != nil {
+		response.ReturnError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := createGameDayResults(payload.Date); err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	results, err := store.FindGameDayResultsReportByID(payload.Date)
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, resultsSummary{
+		GameDayID: results.ID,
+		Users:     len(results.UserScores),
+		Scores:    results.UserScores,
+	})
+}
+
+func adminUpdateLeaderboard(w http.ResponseWriter, r *http.Request) {
+	var payload seasonPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	if payload.Season == "" { // defaults to the current season
+		payload.Season = config.Config.Rapid.Season
+	}
+
+	if err := updateLeaderboard(payload.Season, ""); err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	board, err := store.FindLeaderboardByID(payload.Season)
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, leaderboardSummary{
+		Season:    board.ID,
+		Users:     len(board.Standings),
+		Standings: board.Standings,
+	})
+}
+
+// changes how the season is played, which applies to game day reports created from then on
+func adminUpdateSeason(w http.ResponseWriter, r *http.Request) {
+	var payload seasonSettingsPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	settings, err := findSeasonSettings(mux.Vars(r)["season"])
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	settings.Scoring = payload.Scoring
+	settings.UpsetBonus = payload.UpsetBonus
+	settings.PickType = pickTypeStraight
+
+	if payload.PickType != "" {
+		settings.PickType = payload.PickType
+	}
+
+	if err := store.UpsertSeason(*settings); err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, settings)
+}
+
+func adminImportOdds(w http.ResponseWriter, r *http.Request) {
+	date := mux.Vars(r)["date"]
+
+	if err := validateDates(date); err != nil {
+		response.ReturnError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var payload oddsPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	report, err := importOdds(date, payload.Games)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, errNotFound):
+			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find game day report for %s", date))
+		case errors.Is(err, errInvalidOdds):
+			response.ReturnError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, errGameDayEvaluated), errors.Is(err, errGameLocked):
+			response.ReturnError(w, http.StatusConflict, err.Error())
+		default:
+			log.Error(err.Error())
+			response.ReturnError(w, http.StatusInternalServerError, genericError)
+		}
+
+		return
+	}
+
+	underdogs := make(map[int64]int64)
+	for gameID := range payload.Games {
+		underdogs[gameID] = report.Games[gameID].UnderdogID
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, oddsSummary{
+		GameDayID: report.ID,
+		Underdogs: underdogs,
+	})
+}
+
+func adminSetupBracket(w http.ResponseWriter, r *http.Request) {
+	var payload bracketPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	b := bracket{
+		ID:       mux.Vars(r)["season"],
+		Deadline: payload.Deadline,
+	}
+
+	for _, s := range payload.Series {
+		b.Series = append(b.Series, series{
+			ID:      s.ID,
+			Round:   s.Round,
+			BestOf:  s.BestOf,
+			Teams:   s.Teams,
+			Feeders: s.Feeders,
+		})
+	}
+
+	saved, err := setupBracket(b)
+
+	if err != nil {
+		if errors.Is(err, errInvalidBracket) {
+			response.ReturnError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, saved)
+}
+
+// starts polling every date of the season and creating the upcoming game day reports, see importSeason
+// the import runs in the background, so the response is its run in the job history
+func adminImportSeason(w http.ResponseWriter, r *http.Request) {
+	var payload seasonImportPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	run, err := startSeasonImport(payload.From, payload.To)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidImportRange):
+			response.ReturnError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, errImportRunning):
+			response.ReturnError(w, http.StatusConflict, err.Error())
+		default:
+			log.Error(err.Error())
+			response.ReturnError(w, http.StatusInternalServerError, genericError)
+		}
+
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusAccepted, run)
+}
+
+// the scheduled jobs and their most recent runs, ?limit= sets how many runs (50 by default)
+func adminGetJobs(w http.ResponseWriter, r *http.Request) {
+	limit := defaultJobRunsLimit
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+
+		if err != nil || parsed < 1 || parsed > maxJobRunsLimit {
+			response.ReturnError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxJobRunsLimit))
+			return
+		}
+
+		limit = parsed
+	}
+
+	summary, err := findJobsSummary(limit)
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, summary)
+}
+
+// how much of the Rapid API budget is left today
+func adminGetQuota(w http.ResponseWriter, r *http.Request) {
+	if rapidLimiter == nil {
+		response.ReturnError(w, http.StatusNotFound, "the Rapid API is not rate limited")
+		return
+	}
+
+	quota, err := rapidLimiter.Quota()
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, quota)
+}
+
+// manually corrects a game, e.g. when the upstream data is wrong or missing
+func adminOverrideGame(w http.ResponseWriter, r *http.Request) {
+	gameID, err := strconv.ParseInt(mux.Vars(r)["gameId"], 10, 64)
+
+	if err != nil {
+		response.ReturnError(w, http.StatusBadRequest, "game id must be a number")
+		return
+	}
+
+	var payload gameOverridePayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	before, err := store.FindMatchByID(gameID)
+
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find game %d", gameID))
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	after := *before
+	after.Status = payload.Status
+	after.State = gameStateFromStatus(payload.Status)
+	after.HomeTeam.Score = payload.HomeScore
+	after.AwayTeam.Score = payload.AwayScore
+	after.WinnerID = 0
+	after.Overridden = true
+
+	if after.State == stateFinished {
+		after.WinnerID = determineWinner(after.HomeTeam, after.AwayTeam)
+	}
+
+	if err := store.UpsertMatch(after); err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	// polling keeps the overridden game as it is, so the bracket needs deciding again here
+	if after.SeasonStage == seasonStagePlayoffs {
+		if err := updateBracket(after.SeasonID); err != nil {
+			log.Error(err.Error())
+			response.ReturnError(w, http.StatusInternalServerError, genericError)
+			return
+		}
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, gameOverrideSummary{
+		Before: *before,
+		After:  after,
+	})
+}
+
+// decodes the json body into the payload and validates it, writing the error response if either fails
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, payload interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+		response.ReturnError(w, http.StatusBadRequest, "could not decode json payload")
+		return false
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		response.ReturnError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	return true
+}
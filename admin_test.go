@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	clockPkg "nba-pick-and-play/pkg/clock"
+	"nba-pick-and-play/pkg/rapid"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminRouterForbidsUsers(t *testing.T) {
+	defer cleanDatabase(t)
+
+	user := createUser(t, "keegan")
+	assert.Equal(t, roleUser, user.Role)
+
+	status, response := callEndpoint(t, user, "POST", "/v1/admin/poll", pollPayload{Dates: []string{"2020-01-18"}})
+
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, "requires the admin role", response.Error)
+}
+
+func TestAdminRoleFollowsConfig(t *testing.T) {
+	defer cleanDatabase(t)
+
+	user := createUser(t, "keegan")
+	assert.Equal(t, roleUser, user.Role)
+
+	admins := config.Config.Auth.Admins
+	defer func() { config.Config.Auth.Admins = admins }()
+
+	// made an admin after signing up
+	config.Config.Auth.Admins = []string{"admin", "Keegan"}
+
+	status, _ := callEndpoint(t, user, "GET", "/v1/admin/jobs", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	// and no longer one
+	config.Config.Auth.Admins = []string{"admin"}
+
+	status, _ = callEndpoint(t, user, "GET", "/v1/admin/jobs", nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestAdminPollGames(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+	assert.Equal(t, roleAdmin, admin.Role)
+
+	status, response := callEndpoint(t, admin, "POST", "/v1/admin/poll", pollPayload{Dates: []string{"2020-01-18", "2020-01-19"}})
+	assert.Equal(t, http.StatusOK, status)
+
+	var summary pollSummary
+	err := json.Unmarshal(response.Data, &summary)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 9, summary.GamesUpdated["2020-01-18"])
+	assert.Equal(t, 10, summary.GamesUpdated["2020-01-19"])
+
+	// dates are validated before anything is polled
+	status, response = callEndpoint(t, admin, "POST", "/v1/admin/poll", pollPayload{Dates: []string{"18-01-2020"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "date 18-01-2020 is not in the format YYYY-MM-DD", response.Error)
+}
+
+func TestAdminEvaluateGameDay(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	status, response := callEndpoint(t, admin, "POST", "/v1/admin/reports", gameDayPayload{Date: "2020-01-18"})
+	assert.Equal(t, http.StatusOK, status)
+
+	var reportSummary gameDayReportSummary
+	err = json.Unmarshal(response.Data, &reportSummary)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, reportSummary.Games)
+
+	// no games have been saved for the day
+	status, response = callEndpoint(t, admin, "POST", "/v1/admin/reports", gameDayPayload{Date: "2020-01-20"})
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "no matches found for date 2020-01-20", response.Error)
+
+	err = store.UpsertGameDayPicks(gameDayPicks{
+		UserID:    admin.ID,
+		GameDayID: "2020-01-18",
+		SeasonID:  "2019",
+		Picks:     createPicks(),
+	})
+	assert.Nil(t, err)
+
+	rapidAPIClient = rapid.NewMockRapidClient(map[string]string{
+		"2020-01-18": "test/2020-01-18_nextday.json",
+		"2020-01-19": "test/2020-01-19_nextday.json",
+	})
+
+	defer setDefaultMockRapidAPIClient()
+
+	err = pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	status, response = callEndpoint(t, admin, "POST", "/v1/admin/evaluate", gameDayPayload{Date: "2020-01-18"})
+	assert.Equal(t, http.StatusOK, status)
+
+	var evaluation evaluationSummary
+	err = json.Unmarshal(response.Data, &evaluation)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, evaluation.PicksEvaluated)
+
+	status, response = callEndpoint(t, admin, "POST", "/v1/admin/results", gameDayPayload{Date: "2020-01-18"})
+	assert.Equal(t, http.StatusOK, status)
+
+	var results resultsSummary
+	err = json.Unmarshal(response.Data, &results)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, results.Users)
+	assert.Equal(t, "admin", results.Scores[0].Username)
+	assert.Equal(t, int64(7), results.Scores[0].Score)
+
+	status, response = callEndpoint(t, admin, "POST", "/v1/admin/leaderboard", seasonPayload{})
+	assert.Equal(t, http.StatusOK, status)
+
+	var board leaderboardSummary
+	err = json.Unmarshal(response.Data, &board)
+	assert.Nil(t, err)
+	assert.Equal(t, "2019", board.Season)
+	assert.Equal(t, 1, board.Users)
+
+	// correcting a result and evaluating again re-scores the picks, the results and the leaderboard
+	status, _ = callEndpoint(t, admin, "PUT", "/v1/admin/games/7015", gameOverridePayload{
+		Status:    statusFinished,
+		HomeScore: 140,
+		AwayScore: 133,
+	})
+	assert.Equal(t, http.StatusOK, status)
+
+	status, response = callEndpoint(t, admin, "POST", "/v1/admin/evaluate", gameDayPayload{Date: "2020-01-18"})
+	assert.Equal(t, http.StatusOK, status)
+
+	err = json.Unmarshal(response.Data, &evaluation)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, evaluation.PicksEvaluated)
+
+	picks, err := findUserPicks("2020-01-18", admin.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, pickCorrect, picks[7015].Status)
+
+	gameDayResults, err := store.FindGameDayResultsReportByID("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), gameDayResults.UserScores[0].Score)
+
+	leaderboard, err := store.FindLeaderboardByID("2019")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), leaderboard.Standings[0].Score)
+}
+
+func TestAdminOverrideGame(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+
+	err := pollGames("2020-01-18")
+	assert.Nil(t, err)
+
+	status, response := callEndpoint(t, admin, "PUT", "/v1/admin/games/7015", gameOverridePayload{Status: "Done"})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	game, err := store.FindMatchByID(7015)
+	assert.Nil(t, err)
+	assert.False(t, game.Overridden)
+
+	payload := gameOverridePayload{
+		Status:    statusFinished,
+		HomeScore: 101,
+		AwayScore: 99,
+	}
+
+	status, response = callEndpoint(t, admin, "PUT", "/v1/admin/games/7015", payload)
+	assert.Equal(t, http.StatusOK, status)
+
+	var summary gameOverrideSummary
+	err = json.Unmarshal(response.Data, &summary)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "Scheduled", summary.Before.Status)
+	assert.Equal(t, statusFinished, summary.After.Status)
+	assert.Equal(t, int64(23), summary.After.WinnerID)
+
+	game, err = store.FindMatchByID(7015)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(101), game.HomeTeam.Score)
+	assert.True(t, game.Overridden)
+
+	// polling again doesn't undo the override
+	err = pollGames("2020-01-18")
+	assert.Nil(t, err)
+
+	game, err = store.FindMatchByID(7015)
+	assert.Nil(t, err)
+	assert.Equal(t, statusFinished, game.Status)
+	assert.Equal(t, int64(101), game.HomeTeam.Score)
+
+	other, err := store.FindMatchByID(7016)
+	assert.Nil(t, err)
+	assert.False(t, other.Overridden)
+
+	status, response = callEndpoint(t, admin, "PUT", fmt.Sprintf("/v1/admin/games/%d", 1), payload)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "could not find game 1", response.Error)
+}
+
+func TestAdminUpdateSeason(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+
+	status, response := callEndpoint(t, admin, "PUT", "/v1/admin/seasons/2019", seasonSettingsPayload{Scoring: "most points"})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, response = callEndpoint(t, admin, "PUT", "/v1/admin/seasons/2019", seasonSettingsPayload{Scoring: scoringConfidence})
+	assert.Equal(t, http.StatusOK, status)
+
+	var settings season
+	err := json.Unmarshal(response.Data, &settings)
+	assert.Nil(t, err)
+	assert.Equal(t, "2019", settings.ID)
+	assert.Equal(t, scoringConfidence, settings.Scoring)
+
+	// new reports pick up the season's scoring
+	err = pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	report, err := createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, scoringConfidence, report.Scoring)
+
+	// but existing reports keep theirs when they're rebuilt
+	status, _ = callEndpoint(t, admin, "PUT", "/v1/admin/seasons/2019", seasonSettingsPayload{Scoring: scoringStandard, UpsetBonus: 2, PickType: pickTypeSpread})
+	assert.Equal(t, http.StatusOK, status)
+
+	report, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, scoringConfidence, report.Scoring)
+	assert.Equal(t, int64(0), report.UpsetBonus)
+	assert.Equal(t, pickTypeStraight, report.PickType)
+
+	report, err = createGameDayReport("2020-01-19")
+	assert.Nil(t, err)
+	assert.Equal(t, scoringStandard, report.Scoring)
+	assert.Equal(t, int64(2), report.UpsetBonus)
+	assert.Equal(t, pickTypeSpread, report.PickType)
+}
+
+func TestAdminImportOdds(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	status, _ := callEndpoint(t, admin, "PUT", "/v1/admin/reports/2020-01-18/odds", oddsPayload{
+		Games: map[int64]odds{7015: {HomeMoneyline: 50, AwayMoneyline: -150}},
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = callEndpoint(t, admin, "PUT", "/v1/admin/reports/2020-01-17/odds", oddsPayload{
+		Games: map[int64]odds{7015: {HomeMoneyline: 130, AwayMoneyline: -150}},
+	})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, response := callEndpoint(t, admin, "PUT", "/v1/admin/reports/2020-01-18/odds", oddsPayload{
+		Games: map[int64]odds{7015: {HomeMoneyline: 130, AwayMoneyline: -150}},
+	})
+	assert.Equal(t, http.StatusOK, status)
+
+	var summary oddsSummary
+	err = json.Unmarshal(response.Data, &summary)
+	assert.Nil(t, err)
+	assert.Equal(t, map[int64]int64{7015: 23}, summary.Underdogs)
+
+	// the odds survive the report being recreated
+	report, err := createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, &odds{HomeMoneyline: 130, AwayMoneyline: -150}, report.Games[7015].Odds)
+	assert.Equal(t, int64(23), report.Games[7015].UnderdogID)
+
+	// once a game tips off its odds are fixed
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 18, 21, 0, 0, 0, time.UTC))
+	defer setDefaultMockClock()
+
+	status, response = callEndpoint(t, admin, "PUT", "/v1/admin/reports/2020-01-18/odds", oddsPayload{
+		Games: map[int64]odds{7015: {HomeMoneyline: -150, AwayMoneyline: 130}},
+	})
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Contains(t, response.Error, errGameLocked.Error())
+
+	report, err = store.FindGameDayReportByID("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, &odds{HomeMoneyline: 130, AwayMoneyline: -150}, report.Games[7015].Odds)
+}
+
+func TestAdminQuota(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+
+	status, _ := callEndpoint(t, admin, "GET", "/v1/admin/quota", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	rapidLimiter = rapid.NewLimiter(rapid.Limits{PerDay: 3}, apiUsageStore{}, clock)
+	setLimitedRapidAPIClient(t, rapidLimiter)
+
+	defer func() {
+		rapidLimiter = nil
+		setDefaultMockRapidAPIClient()
+	}()
+
+	// used before a restart
+	err := store.UpsertAPIUsage(apiUsage{ID: "2020-01-18", Requests: 1})
+	assert.Nil(t, err)
+
+	status, _ = callEndpoint(t, admin, "POST", "/v1/admin/poll", pollPayload{Dates: []string{"2020-01-18", "2020-01-19"}})
+	assert.Equal(t, http.StatusOK, status)
+
+	status, response := callEndpoint(t, admin, "POST", "/v1/admin/poll", pollPayload{Dates: []string{"2020-01-17"}})
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Contains(t, response.Error, "daily budget used up")
+
+	status, response = callEndpoint(t, admin, "GET", "/v1/admin/quota", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var quota rapid.Quota
+	err = json.Unmarshal(response.Data, &quota)
+	assert.Nil(t, err)
+	assert.Equal(t, rapid.Quota{Day: "2020-01-18", Used: 3, PerDay: 3, Remaining: 0, UsedLastMinute: 2}, quota)
+}
+
+func TestAdminImportSeason(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+
+	status, response := callEndpoint(t, admin, "POST", "/v1/admin/import", seasonImportPayload{From: "2020-01-18", To: "2020-01-17"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid import range: 2020-01-17 is before 2020-01-18", response.Error)
+
+	status, response = callEndpoint(t, admin, "POST", "/v1/admin/import", seasonImportPayload{From: "2020-01-17", To: "2020-01-18"})
+	assert.Equal(t, http.StatusAccepted, status)
+
+	var run jobRun
+	err := json.Unmarshal(response.Data, &run)
+	assert.Nil(t, err)
+	assert.Equal(t, jobImport, run.Job)
+	assert.Equal(t, jobRunning, run.Status)
+
+	// the day after is polled too, for the late games, and only game days still to come get a report
+	run = waitForJobRun(t, run.ID)
+	assert.Equal(t, jobSucceeded, run.Status)
+	assert.Equal(t, "imported 24 games from 3 dates, created 1 game day reports", run.Progress)
+
+	report, err := store.FindGameDayReportByID("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, 11, len(report.Games))
+
+	_, err = store.FindGameDayReportByID("2020-01-17")
+	assert.True(t, errors.Is(err, errNotFound))
+}
+
+func TestAdminImportSeasonOutOfQuota(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+
+	setLimitedRapidAPIClient(t, rapid.NewLimiter(rapid.Limits{PerDay: 2}, apiUsageStore{}, clock))
+	defer setDefaultMockRapidAPIClient()
+
+	status, response := callEndpoint(t, admin, "POST", "/v1/admin/import", seasonImportPayload{From: "2020-01-17", To: "2020-01-18"})
+	assert.Equal(t, http.StatusAccepted, status)
+
+	var run jobRun
+	err := json.Unmarshal(response.Data, &run)
+	assert.Nil(t, err)
+
+	run = waitForJobRun(t, run.ID)
+	assert.Equal(t, jobSucceeded, run.Status)
+	assert.Contains(t, run.Progress, "from 2 dates")
+	assert.Contains(t, run.Progress, "the Rapid API quota ran out so import again from 2020-01-19")
+}
+
+func TestAdminImportSeasonAlreadyRunning(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+
+	importingSeason = 1
+	defer func() { importingSeason = 0 }()
+
+	status, response := callEndpoint(t, admin, "POST", "/v1/admin/import", seasonImportPayload{From: "2020-01-17", To: "2020-01-18"})
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, errImportRunning.Error(), response.Error)
+}
+
+// waits for a job run started in the background to finish
+func waitForJobRun(t *testing.T, id string) jobRun {
+	for i := 0; i < 200; i++ {
+		runs, err := store.FindRecentJobRuns(maxJobRunsLimit)
+		assert.Nil(t, err)
+
+		for _, run := range runs {
+			if run.ID == id && run.Status != jobRunning {
+				return run
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("job run %s never finished", id)
+	return jobRun{}
+}
+
+func TestAdminGetJobs(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+
+	err := setupScheduler()
+	assert.Nil(t, err)
+
+	defer func() {
+		scheduler = nil
+		scheduledJobs = nil
+	}()
+
+	runScheduledJob(jobResults, func() error {
+		return errors.New("rapid is down")
+	})
+
+	status, response := callEndpoint(t, admin, "GET", "/v1/admin/jobs", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var summary jobsSummary
+	err = json.Unmarshal(response.Data, &summary)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(summary.Jobs))
+	assert.Equal(t, jobResults, summary.Jobs[0].Name)
+	assert.Equal(t, "0 9 * * *", summary.Jobs[0].Spec)
+
+	assert.Equal(t, 1, len(summary.Runs))
+	assert.Equal(t, jobFailed, summary.Runs[0].Status)
+	assert.Equal(t, "rapid is down", summary.Runs[0].Error)
+
+	assert.Equal(t, "test-instance", summary.Instance)
+	assert.NotNil(t, summary.Lease)
+	assert.Equal(t, "test-instance", summary.Lease.Holder)
+
+	status, _ = callEndpoint(t, admin, "GET", "/v1/admin/jobs?limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	"sort"
+	"time"
+)
+
+const maxBackfillDays = 30 // how far back a catch up will go, anything older needs an admin
+
+/*
+	Catches up on every game day from the one after the leaderboard's LastGameDayEvaluated up to yesterday, in order,
+	so a day the service was down for (or whose games hadn't finished by the daily run) still gets evaluated.
+
+	Each game day is polled again first, as its games were last saved before they had finished. Catching up stops at
+	the first game day which still isn't final, so game days are never evaluated out of order. Returns the number of
+	game days evaluated.
+*/
+func backfillGameDays() (int, error) {
+	dates, err := backfillDates()
+
+	if err != nil || len(dates) == 0 {
+		return 0, err
+	}
+
+	return catchUpGameDays(dates)
+}
+
+// the dates a catch up polls, every game day to catch up on and the day after the last for its late games
+// none if there's nothing to catch up on
+func backfillDates() ([]string, error) {
+	yesterday := inScheduleLocation(clock.Now()).Add(-24 * time.Hour).Format(basicDateFormat)
+
+	start, err := backfillStart(config.Config.Rapid.Season, yesterday)
+
+	if err != nil || start == "" || start > yesterday {
+		return nil, err
+	}
+
+	return importDates(start, yesterday)
+}
+
+// polls the dates from backfillDates, then evaluates each game day but the last date in order
+func catchUpGameDays(dates []string) (int, error) {
+	season := config.Config.Rapid.Season
+	yesterday := dates[len(dates)-2]
+
+	if err := pollGames(dates...); err != nil {
+		return 0, err
+	}
+
+	evaluated := 0
+	for _, gameDay := range dates[:len(dates)-1] {
+		games, err := store.FindMatchesByGameDateID(gameDay)
+
+		if err != nil {
+			return evaluated, err
+		}
+
+		if len(games) > 0 {
+			if _, err := evaluateGameDayReport(gameDay); err != nil {
+				if errors.Is(err, errGameDayNotFinal) { // try again on the next run
+					log.Warnf("stopping the catch up at %s: %s", gameDay, err.Error())
+					return evaluated, nil
+				}
+
+				return evaluated, fmt.Errorf("when catching up on %s: %w", gameDay, err)
+			}
+
+			if err := createGameDayResults(gameDay); err != nil {
+				return evaluated, err
+			}
+
+			evaluated++
+		}
+
+		// game days without any games are caught up on too, so they aren't polled again on the next run
+		if err := updateLeaderboard(season, gameDay); err != nil {
+			return evaluated, err
+		}
+	}
+
+	if evaluated > 0 {
+		log.Printf("Caught up on %d game day(s) up to %s", evaluated, yesterday)
+	}
+
+	return evaluated, nil
+}
+
+// the game day after the last one evaluated, or the season's first game day if none have been
+// never more than maxBackfillDays before the last game day
+func backfillStart(season string, lastGameDay string) (string, error) {
+	last, _ := time.Parse(basicDateFormat, lastGameDay)
+	earliest := last.Add(-(maxBackfillDays - 1) * 24 * time.Hour).Format(basicDateFormat)
+
+	board, err := store.FindLeaderboardByID(season)
+
+	if err != nil && !errors.Is(err, errNotFound) {
+		return "", err
+	}
+
+	var start string
+
+	if err == nil && board.LastGameDayEvaluated != "" {
+		evaluated, err := time.Parse(basicDateFormat, board.LastGameDayEvaluated)
+
+		if err != nil {
+			return "", err
+		}
+
+		start = evaluated.Add(24 * time.Hour).Format(basicDateFormat)
+	} else {
+		games, err := store.FindMatchesBySeasonID(season)
+
+		if err != nil {
+			return "", err
+		}
+
+		var gameDays []string
+		for _, game := range games {
+			gameDays = append(gameDays, game.GameDayID)
+		}
+
+		if len(gameDays) == 0 {
+			return "", nil // nothing to catch up on
+		}
+
+		sort.Strings(gameDays)
+		start = gameDays[0]
+	}
+
+	if start < earliest {
+		log.Warnf("only catching up on the last %d days, from %s rather than %s", maxBackfillDays, earliest, start)
+		start = earliest
+	}
+
+	return start, nil
+}
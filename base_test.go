@@ -1,15 +1,22 @@
 package main
 
 import (
-	"context"
+	"bytes"
+	"encoding/json"
 	"nba-pick-and-play/config"
+	"nba-pick-and-play/pkg/auth"
 	clockPkg "nba-pick-and-play/pkg/clock"
 	"nba-pick-and-play/pkg/rapid"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/go-playground/validator.v9"
 )
 
 func setDefaultMockRapidAPIClient() {
@@ -22,6 +29,16 @@ func setDefaultMockRapidAPIClient() {
 	rapidAPIClient = rapid.NewMockRapidClient(matchesToFiles)
 }
 
+// serves the test files to a real API client, which counts its requests against the limiter
+func setLimitedRapidAPIClient(t *testing.T, limiter *rapid.Limiter) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "test"+r.URL.Path+".json")
+	}))
+	t.Cleanup(server.Close)
+
+	rapidAPIClient = rapid.NewRapidAPIClient(server.URL+"/", "key", rapid.Options{MaxRetries: -1, Limiter: limiter})
+}
+
 func setDefaultMockClock() {
 	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 18, 12, 0, 0, 0, time.UTC))
 }
@@ -31,61 +48,56 @@ func init() {
 
 	config.LoadConfig("config/config_test.toml")
 
-	setupDatabase()
+	store = newTestStore()
+
+	validate = validator.New()
+
+	tokenSigner = auth.NewSigner(config.Config.Auth.Secret)
+
+	instanceID = "test-instance"
 
 	// mock API to return the json test files data as responses
+	provider = rapidProvider{}
 	setDefaultMockRapidAPIClient()
 
 	// change time to be 18th Jan 2020 noon instead of the actual time.Now()
 	setDefaultMockClock()
 }
-func cleanDatabase(t *testing.T) {
-	db := getDatabase()
 
-	_, err := db.Collection(gamesCollection).DeleteMany(
-		context.Background(),
-		bson.M{},
-	)
+// every test gets a fresh in-memory store, so no database is needed
+func cleanDatabase(t *testing.T) {
+	store = newTestStore()
+}
 
-	if err != nil {
-		log.Fatalf("Failed to drop collection: %s", err.Error())
+// NBA_TEST_STORE=sqlite runs the tests against an in-memory sqlite database instead
+func newTestStore() Store {
+	if os.Getenv("NBA_TEST_STORE") != "sqlite" {
+		return newMemoryStore()
 	}
 
-	_, err = db.Collection(gameDaysCollection).DeleteMany(
-		context.Background(),
-		bson.M{},
-	)
+	sqlStore, err := newSQLStore(driverSQLite, ":memory:")
 
 	if err != nil {
-		log.Fatalf("Failed to drop collection: %s", err.Error())
+		log.Fatalf("Failed to create sqlite store: %s", err.Error())
 	}
 
-	_, err = db.Collection(picksCollection).DeleteMany(
-		context.Background(),
-		bson.M{},
-	)
-
-	if err != nil {
-		log.Fatalf("Failed to drop collection: %s", err.Error())
-	}
+	return sqlStore
+}
 
-	_, err = db.Collection(gameDayResultsCollection).DeleteMany(
-		context.Background(),
-		bson.M{},
-	)
+// registers a user and returns them for use as the caller of an endpoint
+func createUser(t *testing.T, username string) *user {
+	user, err := registerUser(username, "password123")
 
 	if err != nil {
-		log.Fatalf("Failed to drop collection: %s", err.Error())
+		t.Fatalf("Failed to create user: %s", err.Error())
 	}
 
-	_, err = db.Collection(leaderboardCollection).DeleteMany(
-		context.Background(),
-		bson.M{},
-	)
+	return user
+}
 
-	if err != nil {
-		log.Fatalf("Failed to drop collection: %s", err.Error())
-	}
+// attaches the user to the request as if they had passed the auth middleware
+func requestAsUser(req *http.Request, user *user) *http.Request {
+	return req.WithContext(contextWithUser(req.Context(), user))
 }
 
 func createPicks() map[int64]pick {
@@ -136,3 +148,40 @@ func createPicks() map[int64]pick {
 		},
 	}
 }
+
+type (
+	endpointResponse struct {
+		Code      int             `json:"code"`
+		Data      json.RawMessage `json:"data,omitempty"`
+		Error     string          `json:"error,omitempty"`
+		CreatedAt string          `json:"createdAt"`
+	}
+)
+
+// calls an endpoint through the router as the caller, so the auth middleware is applied too
+func callEndpoint(t *testing.T, caller *user, method string, path string, payload interface{}) (int, endpointResponse) {
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(payload)
+
+	req, err := http.NewRequest(method, path, body)
+	assert.Nil(t, err)
+
+	tokens, err := issueTokens(caller)
+	assert.Nil(t, err)
+
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	router := mux.NewRouter()
+	initRouter(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	res := w.Result()
+
+	var response endpointResponse
+	err = json.NewDecoder(res.Body).Decode(&response)
+	assert.Nil(t, err)
+
+	return res.StatusCode, response
+}
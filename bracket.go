@@ -0,0 +1,346 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type (
+	bracketStanding struct {
+		UserID   int64  `json:"userId"`
+		Username string `json:"username"`
+		Score    int64  `json:"score"`
+	}
+
+	bracketView struct {
+		Bracket   *bracket          `json:"bracket"`
+		Entry     *bracketEntry     `json:"entry,omitempty"` // the caller's predictions, if they've made any
+		Standings []bracketStanding `json:"standings"`
+	}
+)
+
+const (
+	seasonStagePlayoffs = "4" // as given by rapid
+	defaultSeriesLength = 7
+	seriesLengthBonus   = 1 // on top of the round's points for also getting the number of games right
+)
+
+var (
+	errInvalidBracket = errors.New("invalid bracket")
+	errBracketLocked  = errors.New("bracket predictions are locked")
+)
+
+func bracketEntryID(seasonID string, userID int64) string {
+	return fmt.Sprintf("%s:%d", seasonID, userID)
+}
+
+// a correct series winner is worth 1 point in the first round, doubling every round after
+func roundPoints(round int) int64 {
+	return int64(1) << uint(round-1)
+}
+
+func (s series) winsNeeded() int {
+	return s.BestOf/2 + 1
+}
+
+// saves the season's bracket, deciding any series which have already been played
+func setupBracket(b bracket) (*bracket, error) {
+	for i := range b.Series {
+		if b.Series[i].BestOf == 0 {
+			b.Series[i].BestOf = defaultSeriesLength
+		}
+
+		b.Series[i].Wins = map[int64]int{}
+	}
+
+	if err := validateBracket(b); err != nil {
+		return nil, err
+	}
+
+	if err := store.UpsertBracket(b); err != nil {
+		return nil, err
+	}
+
+	if err := updateBracket(b.ID); err != nil {
+		return nil, err
+	}
+
+	return store.FindBracketBySeasonID(b.ID)
+}
+
+// first round series need both teams, every later series is fed by two series from the round before
+func validateBracket(b bracket) error {
+	if len(b.Series) == 0 {
+		return fmt.Errorf("%w: no series", errInvalidBracket)
+	}
+
+	byID := make(map[string]series)
+	for _, s := range b.Series {
+		if _, ok := byID[s.ID]; ok || s.ID == "" {
+			return fmt.Errorf("%w: series ids must be unique and not empty", errInvalidBracket)
+		}
+
+		if s.BestOf < 1 || s.BestOf%2 == 0 {
+			return fmt.Errorf("%w: series %s must be best of an odd number of games", errInvalidBracket, s.ID)
+		}
+
+		byID[s.ID] = s
+	}
+
+	fed := make(map[string]bool)
+	for _, s := range b.Series {
+		if s.Round == 1 {
+			if s.Teams[0] == 0 || s.Teams[1] == 0 || s.Teams[0] == s.Teams[1] {
+				return fmt.Errorf("%w: first round series %s needs two teams", errInvalidBracket, s.ID)
+			}
+
+			continue
+		}
+
+		if s.Round < 1 || s.Teams != [2]int64{} {
+			return fmt.Errorf("%w: series %s gets its teams from the series feeding it", errInvalidBracket, s.ID)
+		}
+
+		for _, feederID := range s.Feeders {
+			feeder, ok := byID[feederID]
+
+			if !ok || feeder.Round != s.Round-1 || fed[feederID] {
+				return fmt.Errorf("%w: series %s must be fed by two series from round %d", errInvalidBracket, s.ID, s.Round-1)
+			}
+
+			fed[feederID] = true
+		}
+	}
+
+	return nil
+}
+
+// saves the user's predictions, which have to cover the whole bracket and follow on from each other
+func saveBracketPredictions(seasonID string, userID int64, predictions map[string]seriesPrediction) (*bracketEntry, error) {
+	b, err := store.FindBracketBySeasonID(seasonID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !clock.Now().Before(b.Deadline) {
+		return nil, fmt.Errorf("%w: the deadline was %v", errBracketLocked, b.Deadline)
+	}
+
+	if len(predictions) != len(b.Series) {
+		return nil, fmt.Errorf("every one of the %d series needs a prediction", len(b.Series))
+	}
+
+	for _, s := range b.Series {
+		p, ok := predictions[s.ID]
+
+		if !ok {
+			return nil, fmt.Errorf("missing prediction for series %s", s.ID)
+		}
+
+		// later rounds have to be between the teams the user has going through
+		candidates := s.Teams
+		if s.Round > 1 {
+			candidates = [2]int64{predictions[s.Feeders[0]].WinnerID, predictions[s.Feeders[1]].WinnerID}
+		}
+
+		if p.WinnerID == 0 || (p.WinnerID != candidates[0] && p.WinnerID != candidates[1]) {
+			return nil, fmt.Errorf("team %d can't win series %s", p.WinnerID, s.ID)
+		}
+
+		if p.Games < s.winsNeeded() || p.Games > s.BestOf {
+			return nil, fmt.Errorf("series %s must last between %d and %d games", s.ID, s.winsNeeded(), s.BestOf)
+		}
+
+		predictions[s.ID] = seriesPrediction{
+			WinnerID: p.WinnerID,
+			Games:    p.Games,
+			Status:   pickPending,
+		}
+	}
+
+	entry := bracketEntry{
+		ID:          bracketEntryID(seasonID, userID),
+		SeasonID:    seasonID,
+		UserID:      userID,
+		Predictions: predictions,
+	}
+
+	err = store.UpsertBracketEntry(entry)
+	return &entry, err
+}
+
+// decides the bracket's series from the finished playoff games, then rescores everyone's predictions
+// does nothing if the season doesn't have a bracket
+func updateBracket(seasonID string) error {
+	b, err := store.FindBracketBySeasonID(seasonID)
+
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	games, err := store.FindMatchesBySeasonID(seasonID, filter{"seasonStage": seasonStagePlayoffs})
+
+	if err != nil {
+		return err
+	}
+
+	fillMissingStates(games)
+	decideSeries(b, games)
+
+	if err := store.UpsertBracket(*b); err != nil {
+		return err
+	}
+
+	entries, err := store.FindBracketEntriesBySeasonID(seasonID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := store.UpsertBracketEntry(scoreBracketEntry(*b, entry)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// works every series out from scratch, a round at a time so that winners move through to the next round
+func decideSeries(b *bracket, games []game) {
+	sort.SliceStable(b.Series, func(i, j int) bool {
+		return b.Series[i].Round < b.Series[j].Round
+	})
+
+	winners := make(map[string]int64) // series id -> winner
+	for i := range b.Series {
+		s := &b.Series[i]
+
+		if s.Round > 1 {
+			s.Teams = [2]int64{winners[s.Feeders[0]], winners[s.Feeders[1]]}
+		}
+
+		s.Wins = map[int64]int{}
+		s.WinnerID = 0
+		s.Games = 0
+
+		if s.Teams[0] == 0 || s.Teams[1] == 0 {
+			continue
+		}
+
+		for _, g := range games {
+			if g.SeasonStage != seasonStagePlayoffs || g.State != stateFinished || g.WinnerID == 0 || s.WinnerID != 0 {
+				continue
+			}
+
+			if !s.isBetween(g.HomeTeam.ID, g.AwayTeam.ID) {
+				continue
+			}
+
+			s.Wins[g.WinnerID]++
+			s.Games++
+
+			if s.Wins[g.WinnerID] == s.winsNeeded() {
+				s.WinnerID = g.WinnerID
+			}
+		}
+
+		if s.WinnerID == 0 {
+			s.Games = 0 // only given once the series is over
+		}
+
+		winners[s.ID] = s.WinnerID
+	}
+}
+
+func (s series) isBetween(home int64, away int64) bool {
+	return (home == s.Teams[0] && away == s.Teams[1]) || (home == s.Teams[1] && away == s.Teams[0])
+}
+
+func scoreBracketEntry(b bracket, entry bracketEntry) bracketEntry {
+	entry.Score = 0
+
+	for _, s := range b.Series {
+		p, ok := entry.Predictions[s.ID]
+
+		if !ok {
+			continue
+		}
+
+		p.Points = 0
+
+		switch {
+		case s.WinnerID == 0:
+			p.Status = pickPending
+		case s.WinnerID == p.WinnerID:
+			p.Status = pickCorrect
+			p.Points = roundPoints(s.Round)
+
+			if p.Games == s.Games {
+				p.Points += seriesLengthBonus
+			}
+		default:
+			p.Status = pickIncorrect
+		}
+
+		entry.Predictions[s.ID] = p
+		entry.Score += p.Points
+	}
+
+	return entry
+}
+
+// the bracket along with the user's own predictions and everyone's scores
+func findBracketView(seasonID string, userID int64) (*bracketView, error) {
+	b, err := store.FindBracketBySeasonID(seasonID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	view := bracketView{
+		Bracket:   b,
+		Standings: []bracketStanding{},
+	}
+
+	entries, err := store.FindBracketEntriesBySeasonID(seasonID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []int64
+	for _, entry := range entries {
+		userIDs = append(userIDs, entry.UserID)
+	}
+
+	usernames, err := usernamesByID(userIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, entry := range entries {
+		if entry.UserID == userID {
+			view.Entry = &entries[i]
+		}
+
+		view.Standings = append(view.Standings, bracketStanding{
+			UserID:   entry.UserID,
+			Username: usernames[entry.UserID],
+			Score:    entry.Score,
+		})
+	}
+
+	sort.SliceStable(view.Standings, func(i, j int) bool {
+		return view.Standings[i].Score > view.Standings[j].Score
+	})
+
+	return &view, nil
+}
@@ -1,36 +1,97 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
 type (
 	Configuration struct {
-		Profile Profile
-		Mongo   Mongo
-		Rapid   Rapid
+		Profile  Profile
+		Database Database
+		Mongo    Mongo
+		Rapid    Rapid
+		Auth     Auth
+		Odds     Odds
+		Provider Provider
+		Schedule Schedule
 	}
 
 	Profile struct {
 		Flag string
 	}
 
+	//Database which backend to store data in, "mongo" (default), "sqlite" or "postgres"
+	Database struct {
+		Backend string
+		DSN     string // only used by the sql backends, e.g. "nba.db" or "postgres://..."
+	}
+
 	Mongo struct {
 		HostURI string
 		Name    string
 	}
 
 	Rapid struct {
-		Enabled bool
-		Season  string
-		BaseURL string
-		APIKey  string
+		Enabled           bool
+		Season            string
+		BaseURL           string
+		APIKey            string
+		Timeout           Duration // per request, defaults to 10s
+		MaxRetries        int      // on server errors and timeouts, defaults to 3
+		RetryBackoff      Duration // doubled on every retry, defaults to 500ms
+		RequestsPerMinute int      // 0 for no limit
+		RequestsPerDay    int      // 0 for no limit, resets at midnight UTC
+		CacheTTL          Duration // for dates with games still to finish, finished dates are cached for good
+		Mode              string   // "live" (default), "record" to also save responses into FixturesDir or "replay" to only serve them from it
+		FixturesDir       string
+	}
+
+	Auth struct {
+		Secret          string
+		AccessTokenTTL  Duration
+		RefreshTokenTTL Duration
+		Admins          []string
+	}
+
+	//Odds a local json file of odds to fill game day reports from, keyed by game day then game id
+	Odds struct {
+		File string
+	}
+
+	//Provider where games are polled from, "rapid" (default) or "file" to read them from a local json or csv File
+	Provider struct {
+		Source string
+		File   string
+	}
+
+	//Schedule when the scheduled jobs run, and when one game day moves on to the next
+	Schedule struct {
+		Timezone     string   // e.g. "America/New_York", the server's local time if empty
+		RolloverHour int      // the hour of the day the current game day moves on to the next
+		LeaseTTL     Duration // how long the scheduler lease lasts unless renewed, defaults to 30s
+		Jobs         []Job
+	}
+
+	//Job a scheduled job, Name being one of "results", "refresh" or "live" and Spec a cron spec in the Timezone
+	Job struct {
+		Name string
+		Spec string
+	}
+
+	//Duration allows durations such as "15m" to be written in the config
+	Duration struct {
+		time.Duration
 	}
 )
 
+//MinSecretLength the fewest characters Auth.Secret can have, 32 bytes being the size of the HS256 hash
+const MinSecretLength = 32
+
 var (
 	Config Configuration
 )
@@ -47,4 +108,23 @@ func LoadConfig(path string) {
 	if err != nil {
 		log.Fatalf("Config loading failed: %s", err.Error())
 	}
+
+	if err := Config.Validate(); err != nil {
+		log.Fatalf("Config loading failed: %s", err.Error())
+	}
+}
+
+//Validate checks the settings which can't be left to their defaults
+func (c Configuration) Validate() error {
+	if len(c.Auth.Secret) < MinSecretLength {
+		return fmt.Errorf("auth secret must be at least %d characters", MinSecretLength)
+	}
+
+	return nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
 }
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		valid  bool
+	}{
+		{"empty secret", "", false},
+		{"short secret", "test-secret", false},
+		{"long enough secret", strings.Repeat("s", MinSecretLength), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Configuration{Auth: Auth{Secret: test.secret}}.Validate()
+			assert.Equal(t, test.valid, err == nil)
+		})
+	}
+}
+
+func TestConfigFilesAreValid(t *testing.T) {
+	for _, path := range []string{"config_dev.toml", "config_test.toml"} {
+		Config = Configuration{}
+		LoadConfig(path)
+		assert.Nil(t, Config.Validate(), path)
+	}
+}
@@ -3,87 +3,184 @@ package main
 import (
 	"errors"
 	"fmt"
-
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
 	basicDateFormat = "2006-01-02"
 )
 
+var (
+	// returned when a game day can't be evaluated yet as some of its games haven't finished
+	errGameDayNotFinal = errors.New("game day still has games which are not finished")
+	// returned when a report is created for a day without any games
+	errNoMatches = errors.New("no matches found")
+)
+
 // for a given game day, create a report detailing the games being played
 func createGameDayReport(date string) (*gameDayReport, error) {
-	matches, err := findMatchesByGameDateID(date)
+	matches, err := store.FindMatchesByGameDateID(date)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if len(matches) == 0 {
-		return nil, fmt.Errorf("no matches found for date %s", date)
+		return nil, fmt.Errorf("%w for date %s", errNoMatches, date)
+	}
+
+	fillMissingStates(matches)
+
+	records, err := findTeamRecords(matches[0].SeasonID, date)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// keep any odds already imported for the day's games, falling back to the odds file
+	existing, err := store.FindGameDayReportByID(date)
+
+	if err != nil && !errors.Is(err, errNotFound) {
+		return nil, err
+	}
+
+	fileOdds, err := loadOddsFile(date)
+
+	if err != nil {
+		return nil, err
 	}
 
 	reportGames := make(map[int64]gameReport)
 	for _, game := range matches {
 		gameReport := gameReport{
-			HomeTeam: game.HomeTeam,
-			AwayTeam: game.AwayTeam,
-			Venue:    game.Venue,
-			Date:     game.StartDate,
+			HomeTeam:   game.HomeTeam,
+			AwayTeam:   game.AwayTeam,
+			HomeRecord: records[game.HomeTeam.ID],
+			AwayRecord: records[game.AwayTeam.ID],
+			Venue:      game.Venue,
+			Date:       game.StartDate,
+			LockTime:   game.StartDate,
+			State:      game.State,
+		}
+
+		if existingOdds := existing.Games[game.ID].Odds; existingOdds != nil {
+			setOdds(&gameReport, *existingOdds)
+		} else if o, ok := fileOdds[game.ID]; ok {
+			setOdds(&gameReport, o)
+		} else {
+			gameReport.UnderdogID = findUnderdog(gameReport)
 		}
 
 		reportGames[game.ID] = gameReport
 	}
 
+	settings, err := findSeasonSettings(matches[0].SeasonID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// once the report exists picks may have been made under its scoring, so changing the season's settings doesn't change it
+	if existing.Scoring != "" {
+		settings = &season{Scoring: existing.Scoring, UpsetBonus: existing.UpsetBonus, PickType: existing.PickType}
+	}
+
 	report := gameDayReport{
-		ID:        date,
-		Games:     reportGames,
-		Deadline:  matches[0].StartDate,
-		Evaluated: false,
+		ID:         date,
+		Games:      reportGames,
+		Deadline:   matches[0].StartDate,
+		Scoring:    settings.Scoring,
+		UpsetBonus: settings.UpsetBonus,
+		PickType:   settings.PickType,
+		Evaluated:  false,
 	}
 
-	err = upsertGameDayReport(report)
+	err = store.UpsertGameDayReport(report)
 	return &report, err
 }
 
-// for a given game day, get the correct picks and evaluate every pick
-func evaluateGameDayReport(date string) error {
-	report, err := findGameDayReportByID(date)
+// for a given game day, get the correct picks and evaluate every pick, returning how many pick reports were evaluated
+// games that were postponed, cancelled or somehow tied are void, and picks on them don't count
+// as are pushes against the spread on spread game days
+func evaluateGameDayReport(date string) (int, error) {
+	report, err := store.FindGameDayReportByID(date)
 
 	if err != nil {
-		if !errors.Is(err, mongo.ErrNoDocuments) {
-			return err
+		if !errors.Is(err, errNotFound) {
+			return 0, err
 		}
 
 		// report doesn't exist for whatever reason, so make one
 		report, err = createGameDayReport(date)
 
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	games, err := findMatchesByGameDateID(date)
+	// evaluating again, e.g. after a result was corrected, so the results and leaderboard need rebuilding too
+	reevaluating := report.Evaluated
+
+	games, err := store.FindMatchesByGameDateID(date)
 
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	fillMissingStates(games)
+
+	// only evaluate once every game has either finished or been called off
+	for _, game := range games {
+		if game.State != stateFinished && !isVoidState(game.State) {
+			return 0, fmt.Errorf("%w: game %d is %s", errGameDayNotFinal, game.ID, game.State)
+		}
 	}
 
 	for _, game := range games {
 		gameReport := report.Games[game.ID]
 		gameReport.HomeTeam.Score = game.HomeTeam.Score
 		gameReport.AwayTeam.Score = game.AwayTeam.Score
-		gameReport.WinnerID = determineWinner(game.HomeTeam, game.AwayTeam)
+		gameReport.State = game.State
+		gameReport.WinnerID = 0
+		gameReport.ATSWinnerID = 0
+
+		if game.State == stateFinished {
+			gameReport.WinnerID = determineWinner(game.HomeTeam, game.AwayTeam)
+
+			if gameReport.Odds != nil && gameReport.Odds.Spread != nil {
+				gameReport.ATSWinnerID = determineSpreadWinner(game.HomeTeam, game.AwayTeam, *gameReport.Odds.Spread)
+			}
+		}
 
 		report.Games[game.ID] = gameReport
 	}
 
 	report.Evaluated = true
 
-	if err := upsertGameDayReport(*report); err != nil {
-		return err
+	if err := store.UpsertGameDayReport(*report); err != nil {
+		return 0, err
+	}
+
+	if len(games) > 0 {
+		if err := evaluateSurvivorPicks(*report, games[0].SeasonID); err != nil {
+			return 0, err
+		}
+	}
+
+	evaluated, err := evaluatePicks(*report, date)
+
+	if err != nil || !reevaluating {
+		return evaluated, err
+	}
+
+	if err := createGameDayResults(date); err != nil {
+		return evaluated, err
+	}
+
+	if len(games) > 0 {
+		if err := updateLeaderboard(games[0].SeasonID, ""); err != nil {
+			return evaluated, err
+		}
 	}
 
-	err = evaluatePicks(*report, date)
-	return err
+	return evaluated, nil
 }
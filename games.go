@@ -2,13 +2,20 @@ package main
 
 import (
 	"fmt"
-	"nba-pick-and-play/pkg/rapid"
-	"strconv"
+	"nba-pick-and-play/config"
+	"strings"
 	"time"
 )
 
 const (
 	statusFinished = "Finished"
+
+	// our own states for a game, derived from the rapid status
+	stateScheduled = "scheduled"
+	stateLive      = "live"
+	stateFinished  = "finished"
+	statePostponed = "postponed"
+	stateCancelled = "cancelled"
 )
 
 /*
@@ -20,127 +27,165 @@ const (
 func pollGames(dates ...string) error {
 	log.Printf("Polling games for game date(s) %v...", dates)
 
+	playoffGameFinished := false
 	for _, date := range dates {
-		err := pollGameDay(date)
+		_, finished, err := pollGameDay(date)
 
 		if err != nil {
 			log.Error(err.Error())
 			return err
 		}
+
+		playoffGameFinished = playoffGameFinished || finished
 	}
 
 	log.Printf("Successful poll for game date(s) %v...", dates)
+
+	// newly finished playoff games can decide series
+	if !playoffGameFinished {
+		return nil
+	}
+
+	if err := updateBracket(config.Config.Rapid.Season); err != nil {
+		log.Errorf("when updating the playoff bracket: %s", err.Error())
+		return err
+	}
+
 	return nil
 }
 
-func pollGameDay(date string) error {
-	res, err := rapidAPIClient.GetMatchesByDateRequest(date)
+// polls a single date, returning the number of games saved and whether any playoff game has just finished
+func pollGameDay(date string) (int, bool, error) {
+	games, err := provider.GamesByDate(date)
 
 	if err != nil {
-		return fmt.Errorf("could not evaluate matches for date %s: %s", date, err.Error())
+		return 0, false, fmt.Errorf("could not evaluate matches for date %s: %w", date, err)
 	}
 
-	for _, rapidGame := range res.ResponseWrapper.Games {
-		game, err := rapidGameToGame(rapidGame) // convert to our mongo schema
+	games, playoffGameFinished, err := mergeSavedGames(games)
 
-		if err != nil {
-			return fmt.Errorf("could not convert rapid game to game %s: %s", rapidGame.GameID, err.Error())
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err := store.UpsertMatches(games); err != nil {
+		return 0, false, fmt.Errorf("could not save games for date %s: %s", date, err.Error())
+	}
+
+	return len(games), playoffGameFinished, nil
+}
+
+// swaps in the saved game for any an admin has overridden, so polling never undoes their correction,
+// and reports whether any playoff game has finished since it was last saved
+func mergeSavedGames(games []game) ([]game, bool, error) {
+	saved := make(map[int64]game)
+	gameDays := make(map[string]bool)
+
+	for _, polled := range games {
+		if gameDays[polled.GameDayID] {
+			continue
 		}
 
-		err = upsertMatch(*game)
+		gameDays[polled.GameDayID] = true
+
+		matches, err := store.FindMatchesByGameDateID(polled.GameDayID)
 
 		if err != nil {
-			return fmt.Errorf("could not save game %d: %s", game.ID, err.Error())
+			return nil, false, err
+		}
+
+		for _, g := range matches {
+			saved[g.ID] = g
 		}
 	}
 
-	return nil
-}
+	playoffGameFinished := false
+	merged := make([]game, 0, len(games))
 
-func rapidGameToGame(rapidGame rapid.NBAGame) (*game, error) {
-	matchID, err := strconv.ParseInt(rapidGame.GameID, 10, 64)
+	for _, polled := range games {
+		previous, ok := saved[polled.ID]
 
-	if err != nil {
-		return nil, err
-	}
+		if ok && previous.Overridden {
+			polled = previous
+		}
 
-	homeTeam, err := rapidTeamToTeam(rapidGame.HTeam, rapidGame.StatusGame)
+		if polled.SeasonStage == seasonStagePlayoffs && polled.State == stateFinished && (!ok || previous.State != stateFinished) {
+			playoffGameFinished = true
+		}
 
-	if err != nil {
-		return nil, err
+		merged = append(merged, polled)
 	}
 
-	awayTeam, err := rapidTeamToTeam(rapidGame.VTeam, rapidGame.StatusGame)
+	return merged, playoffGameFinished, nil
+}
 
-	if err != nil {
-		return nil, err
+// returns the id of the team with the most points, or 0 if nobody is ahead (e.g. the game never started)
+func determineWinner(home team, away team) int64 {
+	if home.Score > away.Score {
+		return home.ID
 	}
 
-	// TODO: parse date irregularities
-	game := &game{
-		ID:          matchID,
-		SeasonID:    rapidGame.SeasonYear,
-		Status:      rapidGame.StatusGame,
-		SeasonStage: rapidGame.SeasonStage,
-		StartDate:   rapidGame.StartTimeUTC,
-		HomeTeam:    *homeTeam,
-		AwayTeam:    *awayTeam,
-		Venue: venue{
-			Name:    rapidGame.Arena,
-			City:    rapidGame.City,
-			Country: rapidGame.Country,
-		},
+	if away.Score > home.Score {
+		return away.ID
 	}
 
-	if game.Status == statusFinished {
-		game.WinnerID = determineWinner(game.HomeTeam, game.AwayTeam)
+	return 0
+}
+
+// the winner against the spread, or 0 on a push
+func determineSpreadWinner(home team, away team, spread float64) int64 {
+	margin := float64(home.Score-away.Score) + spread
+
+	if margin > 0 {
+		return home.ID
 	}
 
-	// work out the game date id
-	if isPreviousDayGame(rapidGame.StartTimeUTC) {
-		// game date id is for the previous day (e.g. game took place at 3am UTC = 8pm PST)
-		game.GameDayID = rapidGame.StartTimeUTC.Add(-24 * time.Hour).Format(basicDateFormat)
-	} else {
-		// game took place on the date specified
-		game.GameDayID = rapidGame.StartTimeUTC.Format(basicDateFormat)
+	if margin < 0 {
+		return away.ID
 	}
 
-	return game, nil
+	return 0
 }
 
-func rapidTeamToTeam(rapidTeam rapid.NBATeam, status string) (*team, error) {
-	id, err := strconv.ParseInt(rapidTeam.TeamID, 10, 64)
-
-	if err != nil {
-		return nil, err
+// maps the rapid status of a game onto one of our game states
+func gameStateFromStatus(status string) string {
+	switch strings.ToLower(status) {
+	case "finished":
+		return stateFinished
+	case "in play", "halftime", "live":
+		return stateLive
+	case "postponed":
+		return statePostponed
+	case "canceled", "cancelled":
+		return stateCancelled
+	default:
+		return stateScheduled
 	}
+}
 
-	team := team{
-		ID:       id,
-		Name:     rapidTeam.FullName,
-		Nickname: rapidTeam.NickName,
-		Logo:     rapidTeam.Logo,
+// games saved before they had a state only have the rapid status, so their state is worked out from that
+func fillMissingStates(games []game) {
+	for i := range games {
+		if games[i].State == "" {
+			games[i].State = gameStateFromStatus(games[i].Status)
+		}
 	}
+}
 
-	if status == statusFinished {
-		points, err := strconv.ParseInt(rapidTeam.Score.Points, 10, 64)
-
-		if err != nil {
-			return nil, err
+// whether any of the games have tipped off but not yet finished (or been called off)
+func hasGamesInPlay(games []game, now time.Time) bool {
+	for _, game := range games {
+		if !now.Before(game.StartDate) && game.State != stateFinished && !isVoidState(game.State) {
+			return true
 		}
-
-		team.Score = points
 	}
 
-	return &team, nil
+	return false
 }
 
-func determineWinner(home team, away team) int64 {
-	if home.Score > away.Score {
-		return home.ID
-	}
-
-	return away.ID
+// postponed and cancelled games will never have a result on this game day
+func isVoidState(state string) bool {
+	return state == statePostponed || state == stateCancelled
 }
 
 /*
@@ -150,3 +195,13 @@ func determineWinner(home team, away team) int64 {
 func isPreviousDayGame(date time.Time) bool {
 	return date.Hour() < 12 // before/after noon can determine the day
 }
+
+func gameDayIDFor(start time.Time) string {
+	if isPreviousDayGame(start) {
+		// game date id is for the previous day (e.g. game took place at 3am UTC = 8pm PST)
+		return start.Add(-24 * time.Hour).Format(basicDateFormat)
+	}
+
+	// game took place on the date specified
+	return start.Format(basicDateFormat)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+)
+
+const (
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // no 0/O or 1/I, so codes can be read out
+	inviteCodeLength   = 8
+	leagueAttempts     = 5 // to find an unused invite code
+)
+
+var (
+	errLeagueExists     = errors.New("a league with that id or invite code already exists")
+	errInvalidInvite    = errors.New("invite code does not match a league")
+	errNotLeagueMember  = errors.New("not a member of the league")
+	errNoInviteCodeLeft = errors.New("could not find an unused invite code")
+)
+
+// creates a league owned by the user, who is its first member
+func createLeague(owner *user, name string) (*league, error) {
+	for attempt := 0; attempt < leagueAttempts; attempt++ {
+		id, err := randomLeagueID()
+
+		if err != nil {
+			return nil, err
+		}
+
+		code, err := randomInviteCode()
+
+		if err != nil {
+			return nil, err
+		}
+
+		newLeague := league{
+			ID:         id,
+			Name:       strings.TrimSpace(name),
+			InviteCode: code,
+			OwnerID:    owner.ID,
+			Members:    []int64{owner.ID},
+			CreatedAt:  clock.Now(),
+		}
+
+		err = store.InsertLeague(newLeague)
+
+		if errors.Is(err, errLeagueExists) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &newLeague, nil
+	}
+
+	return nil, errNoInviteCodeLeft
+}
+
+// adds the user to the league with the invite code, joining a league twice does nothing
+func joinLeague(member *user, inviteCode string) (*league, error) {
+	existing, err := store.FindLeagueByInviteCode(normaliseInviteCode(inviteCode))
+
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, errInvalidInvite
+		}
+
+		return nil, err
+	}
+
+	if err := store.AddLeagueMember(existing.ID, member.ID); err != nil {
+		return nil, err
+	}
+
+	return store.FindLeagueByID(existing.ID)
+}
+
+// the leagues the user is in, oldest first
+func findUserLeagues(userID int64) ([]league, error) {
+	leagues, err := store.FindLeaguesByMember(userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(leagues, func(i, j int) bool {
+		if leagues[i].CreatedAt.Equal(leagues[j].CreatedAt) {
+			return leagues[i].ID < leagues[j].ID
+		}
+
+		return leagues[i].CreatedAt.Before(leagues[j].CreatedAt)
+	})
+
+	return leagues, nil
+}
+
+// finds the league, which only its members can see the standings of
+func findLeagueForMember(leagueID string, userID int64) (*league, error) {
+	l, err := store.FindLeagueByID(leagueID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.hasMember(userID) {
+		return nil, errNotLeagueMember
+	}
+
+	return l, nil
+}
+
+func (l league) hasMember(userID int64) bool {
+	for _, member := range l.Members {
+		if member == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// narrows the season's leaderboard down to the league, keeping the overall order
+func leagueLeaderboard(board leaderboard, l league) leaderboard {
+	standings := []leaderboardUser{}
+	for _, u := range board.Standings {
+		if l.hasMember(u.UserID) {
+			standings = append(standings, u)
+		}
+	}
+
+	board.Standings = standings
+	return board
+}
+
+// as leagueLeaderboard, for the live standings of a game day
+func leagueLiveLeaderboard(board liveLeaderboard, l league) liveLeaderboard {
+	standings := []liveStanding{}
+	for _, s := range board.Standings {
+		if l.hasMember(s.UserID) {
+			standings = append(standings, s)
+		}
+	}
+
+	board.Standings = standings
+	return board
+}
+
+// narrows the game day's results down to the league
+func leagueResults(results gameDayResults, l league) gameDayResults {
+	scores := []result{}
+	for _, r := range results.UserScores {
+		if l.hasMember(r.UserID) {
+			scores = append(scores, r)
+		}
+	}
+
+	results.UserScores = scores
+	return results
+}
+
+func normaliseInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func randomLeagueID() (string, error) {
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func randomInviteCode() (string, error) {
+	b := make([]byte, inviteCodeLength)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, inviteCodeLength)
+	for i := range b {
+		code[i] = inviteCodeAlphabet[int(b[i])%len(inviteCodeAlphabet)] // 256 is a multiple of 32, so there's no bias
+	}
+
+	return string(code), nil
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nba-pick-and-play/pkg/response"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// pushed to everyone following a game day as its games change
+	liveEvent struct {
+		Type      string      `json:"type"` // one of the live event types
+		GameDayID string      `json:"gameDayId"`
+		GameID    int64       `json:"gameId,omitempty"`
+		Game      *gameReport `json:"game,omitempty"` // as it is now, for score and status events
+		From      string      `json:"from,omitempty"` // the state the game was in, for status events
+		Pick      *pick       `json:"pick,omitempty"` // the user's pick on the game with its provisional status, for pick events
+		userID    int64       // only sent to this user, 0 for everyone
+	}
+
+	// what's sent first, so the client has the whole game day before any changes
+	liveSnapshot struct {
+		Report *gameDayReport `json:"report"`
+		Picks  map[int64]pick `json:"picks"` // the user's picks, with their provisional status
+	}
+
+	// the game day's standings as things stand, worked out on request and never saved
+	liveLeaderboard struct {
+		GameDayID string         `json:"gameDayId"`
+		Evaluated bool           `json:"evaluated"` // the official results are out, see /v1/user/results
+		Standings []liveStanding `json:"standings"`
+	}
+
+	liveStanding struct {
+		UserID    int64  `json:"userId"`
+		Username  string `json:"username"`
+		Correct   int    `json:"correct"`   // picks on games which have finished with the user's pick winning
+		Undecided int    `json:"undecided"` // picks on games still to finish
+		Score     int64  `json:"score"`     // from the correct picks
+		MaxScore  int64  `json:"maxScore"`  // if every undecided pick comes good
+	}
+
+	liveSubscriber struct {
+		gameDayID string
+		userID    int64
+		events    chan liveEvent
+	}
+
+	/*
+		Keeps track of who is following which game day on this instance, and watches the store for changes to those
+		game days' games. Only the instance holding the scheduler lease polls, so watching the store rather than the
+		polls is what lets clients connected to any instance follow along.
+	*/
+	liveHub struct {
+		mu          sync.Mutex
+		subscribers map[*liveSubscriber]bool
+		seen        map[string]map[int64]game // game day id -> its games as they were last checked
+	}
+)
+
+const (
+	liveEventSnapshot = "snapshot"
+	liveEventScore    = "score"  // the score, period or clock of a game changed
+	liveEventStatus   = "status" // a game changed state, e.g. tipped off or finished
+	liveEventPick     = "pick"   // the user's pick on a game which changed, with how it now stands
+
+	pickWinning = "WINNING" // the game is being played and the pick is ahead
+	pickLosing  = "LOSING"
+
+	liveEventBuffer   = 32
+	liveKeepAliveTime = 30 * time.Second
+	liveWatchInterval = 5 * time.Second // how often the store is checked for changes to the games being followed
+)
+
+var liveUpdates = &liveHub{
+	subscribers: make(map[*liveSubscriber]bool),
+	seen:        make(map[string]map[int64]game),
+}
+
+// the game day's games as they are now are what later changes are compared against, if nobody was following it yet
+func (h *liveHub) subscribe(gameDayID string, userID int64) (*liveSubscriber, error) {
+	games, err := store.FindMatchesByGameDateID(gameDayID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &liveSubscriber{
+		gameDayID: gameDayID,
+		userID:    userID,
+		events:    make(chan liveEvent, liveEventBuffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.subscribers[sub] = true
+
+	if _, ok := h.seen[gameDayID]; !ok {
+		h.seen[gameDayID] = gamesByID(games)
+	}
+
+	return sub, nil
+}
+
+func (h *liveHub) unsubscribe(sub *liveSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subscribers, sub)
+
+	for other := range h.subscribers {
+		if other.gameDayID == sub.gameDayID {
+			return
+		}
+	}
+
+	delete(h.seen, sub.gameDayID)
+}
+
+// checks the store for changes every interval, for as long as the service is up
+func (h *liveHub) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for range ticker.C {
+		h.checkForChanges()
+	}
+}
+
+// compares the games of every game day being followed with how they were last checked, publishing what's changed
+func (h *liveHub) checkForChanges() {
+	h.mu.Lock()
+	gameDayIDs := make([]string, 0, len(h.seen))
+	for gameDayID := range h.seen {
+		gameDayIDs = append(gameDayIDs, gameDayID)
+	}
+	h.mu.Unlock()
+
+	for _, gameDayID := range gameDayIDs {
+		games, err := store.FindMatchesByGameDateID(gameDayID)
+
+		if err != nil {
+			log.Errorf("when checking game day %s for live updates: %s", gameDayID, err.Error())
+			continue
+		}
+
+		h.mu.Lock()
+		previous, ok := h.seen[gameDayID]
+		if ok {
+			h.seen[gameDayID] = gamesByID(games)
+		}
+		h.mu.Unlock()
+
+		if !ok {
+			continue // nobody is following it any more
+		}
+
+		if err := publishGameChanges(previous, games); err != nil {
+			log.Errorf("when publishing the live updates for game day %s: %s", gameDayID, err.Error())
+		}
+	}
+}
+
+func gamesByID(games []game) map[int64]game {
+	byID := make(map[int64]game)
+	for _, g := range games {
+		byID[g.ID] = g
+	}
+
+	return byID
+}
+
+// sends the event to everyone following its game day, dropping it for anyone too far behind rather than holding up the poll
+func (h *liveHub) publish(event liveEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		if sub.gameDayID != event.GameDayID || (event.userID != 0 && event.userID != sub.userID) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			log.Warnf("dropping a %s event for user %d, who isn't keeping up", event.Type, sub.userID)
+		}
+	}
+}
+
+/*
+	Tells everyone following a game day what changed between the games as they were last checked and as they are
+	now: a status event when a game changes state, a score event when only its score, period or
+	clock does, and a pick event to each user who picked a game that changed.
+*/
+func publishGameChanges(previous map[int64]game, games []game) error {
+	changed := make(map[string][]game) // game day id -> the games which changed
+
+	for _, polled := range games {
+		before, ok := previous[polled.ID]
+
+		if !ok || !gameChanged(before, polled) {
+			continue
+		}
+
+		changed[polled.GameDayID] = append(changed[polled.GameDayID], polled)
+	}
+
+	for gameDayID, changedGames := range changed {
+		report, err := findLiveGameDayReport(gameDayID)
+
+		if errors.Is(err, errNotFound) {
+			continue // nobody can be following a game day without a report
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, polled := range changedGames {
+			gameReport := report.Games[polled.ID]
+			event := liveEvent{
+				Type:      liveEventScore,
+				GameDayID: gameDayID,
+				GameID:    polled.ID,
+				Game:      &gameReport,
+			}
+
+			if before := previous[polled.ID]; before.State != polled.State {
+				event.Type = liveEventStatus
+				event.From = before.State
+			}
+
+			liveUpdates.publish(event)
+		}
+
+		pickReports, err := store.FindPickReportsByGameDayID(gameDayID)
+
+		if err != nil {
+			return err
+		}
+
+		for _, pickReport := range pickReports {
+			picks := provisionalPicks(*report, pickReport)
+
+			for _, polled := range changedGames {
+				p, ok := picks[polled.ID]
+
+				if !ok {
+					continue
+				}
+
+				liveUpdates.publish(liveEvent{
+					Type:      liveEventPick,
+					GameDayID: gameDayID,
+					GameID:    polled.ID,
+					Pick:      &p,
+					userID:    pickReport.UserID,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+func gameChanged(before game, after game) bool {
+	return before.State != after.State ||
+		before.HomeTeam.Score != after.HomeTeam.Score ||
+		before.AwayTeam.Score != after.AwayTeam.Score ||
+		before.Period != after.Period ||
+		before.Clock != after.Clock
+}
+
+// the game day report with the latest from each game, see markLiveGames
+func findLiveGameDayReport(gameDayID string) (*gameDayReport, error) {
+	report, err := store.FindGameDayReportByID(gameDayID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	games, err := store.FindMatchesByGameDateID(gameDayID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	markLiveGames(report, games)
+	markOpenGames(report, clock.Now())
+
+	return report, nil
+}
+
+// the user's picks with how each stands right now, and what it's worth if it stays that way
+func provisionalPicks(report gameDayReport, picksReport gameDayPicks) map[int64]pick {
+	strategy := scoringStrategyFor(report)
+	picks := make(map[int64]pick)
+
+	for gameID, p := range picksReport.Picks {
+		game, ok := report.Games[gameID]
+
+		if !ok || p.SelectionID == 0 {
+			continue
+		}
+
+		p.Status = provisionalPickStatus(report, game, p.SelectionID)
+		p.Points = nil
+
+		if p.Status == pickCorrect || p.Status == pickWinning {
+			earned := strategy.score(game, p)
+			p.Points = &earned
+		}
+
+		picks[gameID] = p
+	}
+
+	return picks
+}
+
+/*
+	The standings for a game day while it's being played, scoring every pick on a finished game as the evaluation will
+	and counting what the picks on the games still to finish could add. Sorted by score then by the maximum score.
+*/
+func findLiveLeaderboard(gameDayID string) (*liveLeaderboard, error) {
+	report, err := findLiveGameDayReport(gameDayID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pickReports, err := store.FindPickReportsByGameDayID(gameDayID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []int64
+	for _, rep := range pickReports {
+		userIDs = append(userIDs, rep.UserID)
+	}
+
+	usernames, err := usernamesByID(userIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	strategy := scoringStrategyFor(*report)
+	standings := []liveStanding{}
+
+	for _, rep := range pickReports {
+		standing := liveStanding{
+			UserID:   rep.UserID,
+			Username: usernames[rep.UserID],
+		}
+
+		for gameID, p := range rep.Picks {
+			game, ok := report.Games[gameID]
+
+			if !ok || p.SelectionID == 0 {
+				continue
+			}
+
+			worth := strategy.score(game, p).Total
+
+			switch provisionalPickStatus(*report, game, p.SelectionID) {
+			case pickCorrect:
+				standing.Correct++
+				standing.Score += worth
+				standing.MaxScore += worth
+			case pickPending, pickWinning, pickLosing:
+				standing.Undecided++
+				standing.MaxScore += worth
+			}
+		}
+
+		standings = append(standings, standing)
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+
+		return standings[i].MaxScore > standings[j].MaxScore
+	})
+
+	return &liveLeaderboard{
+		GameDayID: gameDayID,
+		Evaluated: report.Evaluated,
+		Standings: standings,
+	}, nil
+}
+
+/*
+	How a pick stands with the game as it is: correct or incorrect once the game has finished, winning or losing while
+	it's being played, and pending before it tips off or while the scores (against the spread, if that's the pick
+	type) are level. Mirrors evaluateUserPicks, so a finished game gives the status the evaluation will.
+*/
+func provisionalPickStatus(report gameDayReport, game gameReport, selectionID int64) string {
+	if isVoidState(game.State) {
+		return pickVoid
+	}
+
+	if game.State != stateLive && game.State != stateFinished {
+		return pickPending
+	}
+
+	leaderID := determineWinner(game.HomeTeam, game.AwayTeam)
+	if report.PickType == pickTypeSpread {
+		leaderID = 0
+
+		if game.Odds != nil && game.Odds.Spread != nil {
+			leaderID = determineSpreadWinner(game.HomeTeam, game.AwayTeam, *game.Odds.Spread)
+		}
+	}
+
+	if game.State == stateFinished {
+		switch leaderID {
+		case 0:
+			return pickVoid
+		case selectionID:
+			return pickCorrect
+		default:
+			return pickIncorrect
+		}
+	}
+
+	switch leaderID {
+	case 0:
+		return pickPending
+	case selectionID:
+		return pickWinning
+	default:
+		return pickLosing
+	}
+}
+
+/*
+	Streams the game day (today's by default) as server-sent events, starting with a snapshot of the report and the
+	user's picks, then an event for every change to its games until the client disconnects.
+*/
+func streamGameDay(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		response.ReturnError(w, http.StatusInternalServerError, "streaming isn't supported")
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+
+	if date == "" {
+		date = getCurrentGameDay(clock.Now())
+	}
+
+	user := userFromContext(r.Context())
+
+	// subscribe before the snapshot, so nothing is missed in between
+	sub, err := liveUpdates.subscribe(date, user.ID)
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	defer liveUpdates.unsubscribe(sub)
+
+	report, err := findLiveGameDayReport(date)
+
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find game day for date %s", date))
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	snapshot := liveSnapshot{
+		Report: report,
+		Picks:  map[int64]pick{},
+	}
+
+	userPicks, err := store.FindPickReportsByGameDayID(date, filter{"userId": user.ID})
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	if len(userPicks) > 0 {
+		snapshot.Picks = provisionalPicks(*report, userPicks[0])
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeLiveEvent(w, liveEventSnapshot, snapshot); err != nil {
+		return
+	}
+
+	flusher.Flush()
+
+	// comments keep proxies from closing the connection while nothing is changing
+	keepAlive := time.NewTicker(liveKeepAliveTime)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-sub.events:
+			if err := writeLiveEvent(w, event.Type, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+func writeLiveEvent(w http.ResponseWriter, eventType string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, encoded)
+	return err
+}
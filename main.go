@@ -3,20 +3,24 @@ package main
 import (
 	"flag"
 	"nba-pick-and-play/config"
+	"nba-pick-and-play/pkg/auth"
 	clockPkg "nba-pick-and-play/pkg/clock"
 	"nba-pick-and-play/pkg/rapid"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/go-playground/validator.v9"
 )
 
 var (
 	clock          clockPkg.Clock
+	provider       gameProvider
 	rapidAPIClient rapid.Client
+	rapidLimiter   *rapid.Limiter // counts the requests rapidAPIClient makes, kept to report the remaining quota
+	store          Store
+	tokenSigner    *auth.Signer
 	validate       *validator.Validate
 
 	log *logrus.Logger
@@ -24,27 +28,67 @@ var (
 
 func main() {
 	configPath := flag.String("config", "config/config_dev.toml", "location of the config to be used")
+	importFrom := flag.String("import-from", "", "import the season's games from this date (YYYY-MM-DD) then exit, instead of serving")
+	importTo := flag.String("import-to", "", "the last date of the season to import")
+	createAdmin := flag.String("create-admin", "", "create the account of this admin, with the password in "+adminPasswordEnv+", then exit")
 	flag.Parse()
 
 	config.LoadConfig(*configPath)
 
 	log = logrus.New()
 
-	setupDatabase()
+	clock = clockPkg.NewClock()
 
-	if config.Config.Rapid.Enabled {
-		c := cron.New()
-		c.AddFunc("0 9 * * *", dailyCron) // 9am daily
-		c.Start()
+	if err := setupScheduleLocation(); err != nil {
+		log.Fatalf("couldn't load the schedule's timezone: %s", err.Error())
 	}
 
+	setupDatabase()
+
 	// interface for the Rapid API requests
-	rapidAPIClient = rapid.NewRapidAPIClient(config.Config.Rapid.BaseURL, config.Config.Rapid.APIKey)
+	if err := setupRapidClient(); err != nil {
+		log.Fatalf("couldn't set up the Rapid API client: %s", err.Error())
+	}
 
-	clock = clockPkg.NewClock()
+	if err := setupProvider(); err != nil {
+		log.Fatalf("couldn't set up the game provider: %s", err.Error())
+	}
+
+	if *importFrom != "" {
+		runSeasonImport(*importFrom, *importTo)
+		return
+	}
+
+	if *createAdmin != "" {
+		runCreateAdmin(*createAdmin)
+		return
+	}
+
+	if config.Config.Rapid.Enabled {
+		// only the instance holding the lease runs the jobs, when several share the database
+		instanceID = newInstanceID()
+		go keepSchedulerLease()
+
+		// catch up on anything missed while the service was down
+		go runScheduledJob(jobBackfill, func() error {
+			_, err := backfillGameDays()
+			return err
+		})
+
+		if err := setupScheduler(); err != nil {
+			log.Fatalf("couldn't set up the scheduler: %s", err.Error())
+		}
+
+		scheduler.Start()
+	}
+
+	tokenSigner = auth.NewSigner(config.Config.Auth.Secret)
 
 	validate = validator.New()
 
+	// pushes changes to the games to the clients following them, whichever instance polled them
+	go liveUpdates.watch(liveWatchInterval)
+
 	router := mux.NewRouter()
 	initRouter(router)
 
@@ -55,65 +99,92 @@ func main() {
 }
 
 func initRouter(router *mux.Router) {
+	authRouter := router.PathPrefix("/v1/auth").Subrouter()
+
+	authRouter.HandleFunc("/register", register).Methods("POST")
+	authRouter.HandleFunc("/login", login).Methods("POST")
+	authRouter.HandleFunc("/refresh", refresh).Methods("POST")
+
 	userRouter := router.PathPrefix("/v1/user").Subrouter()
+	userRouter.Use(requireUser)
 
 	userRouter.HandleFunc("/games", getGameDayReport).Methods("GET")
 	userRouter.HandleFunc("/results", getGameDayResultsReport).Methods("GET")
 	userRouter.HandleFunc("/leaderboards", getLeaderboard).Methods("GET")
+	userRouter.HandleFunc("/leaderboards/live", getLiveLeaderboard).Methods("GET")
 	userRouter.HandleFunc("/picks", makePicks).Methods("POST")
-
-	// TODO: admin router for handling resyncs
+	userRouter.HandleFunc("/survivor", getSurvivorStandings).Methods("GET")
+	userRouter.HandleFunc("/survivor/picks", makeSurvivorPick).Methods("POST")
+	userRouter.HandleFunc("/bracket", getBracket).Methods("GET")
+	userRouter.HandleFunc("/bracket/picks", makeBracketPicks).Methods("POST")
+	userRouter.HandleFunc("/leagues", getLeagues).Methods("GET")
+	userRouter.HandleFunc("/leagues", postLeague).Methods("POST")
+	userRouter.HandleFunc("/leagues/join", postJoinLeague).Methods("POST")
+
+	streamRouter := router.PathPrefix("/v1/user/live").Subrouter()
+	streamRouter.Use(requireStreamUser)
+
+	streamRouter.HandleFunc("", streamGameDay).Methods("GET")
+
+	adminRouter := router.PathPrefix("/v1/admin").Subrouter()
+	adminRouter.Use(requireUser, requireRole(roleAdmin))
+
+	adminRouter.HandleFunc("/poll", adminPollGames).Methods("POST")
+	adminRouter.HandleFunc("/import", adminImportSeason).Methods("POST")
+	adminRouter.HandleFunc("/reports", adminCreateGameDayReport).Methods("POST")
+	adminRouter.HandleFunc("/reports/{date}/odds", adminImportOdds).Methods("PUT")
+	adminRouter.HandleFunc("/evaluate", adminEvaluateGameDay).Methods("POST")
+	adminRouter.HandleFunc("/results", adminCreateGameDayResults).Methods("POST")
+	adminRouter.HandleFunc("/leaderboard", adminUpdateLeaderboard).Methods("POST")
+	adminRouter.HandleFunc("/games/{gameId}", adminOverrideGame).Methods("PUT")
+	adminRouter.HandleFunc("/seasons/{season}", adminUpdateSeason).Methods("PUT")
+	adminRouter.HandleFunc("/brackets/{season}", adminSetupBracket).Methods("PUT")
+	adminRouter.HandleFunc("/quota", adminGetQuota).Methods("GET")
+	adminRouter.HandleFunc("/jobs", adminGetJobs).Methods("GET")
 }
 
 /*
 	What to do on a daily basis
 
-	- get results of last night's matches
-		- requires two calls to get games either side of midnight
-	- get the upcoming games tomorrow
-		- requires one more call (to get games after midnight tonight)
-	- evaluate last night's matches
-		- get the scores, update the game day report, mark the users picks
+	- catch up on every game day since the last one evaluated, which is normally just last night's
+		- polls the results of those matches, requiring two calls a game day to get games either side of midnight
+		- evaluates them, updating the game day reports and marking the users picks
+	- get the upcoming games tonight
+		- requires one more call (to get games after midnight tonight), as catching up has already polled today
 	- create game day report for tonight's upcoming matches
 */
-func dailyCron() {
-	dateNow := clock.Now()
+func dailyCron() error {
+	dateNow := inScheduleLocation(clock.Now())
 
 	dateToday := dateNow.Format(basicDateFormat)
-	dateYesterday := dateNow.Add(-24 * time.Hour).Format(basicDateFormat)
 	dateTomorrow := dateNow.Add(24 * time.Hour).Format(basicDateFormat)
 
-	// get game information for the 24 hours eitherside of now
-	err := pollGames(dateYesterday, dateToday, dateTomorrow)
+	// don't return if err occurs, still create upcoming report
+	dates, backfillErr := backfillDates()
 
-	if err != nil {
-		log.Error(err.Error())
-		return
+	if backfillErr == nil && len(dates) > 0 {
+		_, backfillErr = catchUpGameDays(dates)
 	}
 
-	// evaluate yesterday's matches
-	err = evaluateGameDayReport(dateYesterday)
-
-	if err != nil { // don't return if err occurs, still create upcoming report
-		log.Error(err.Error())
-	} else {
-		err = createGameDayResults(dateYesterday)
+	if backfillErr != nil {
+		log.Error(backfillErr.Error())
+	}
 
-		if err != nil {
-			log.Error(err.Error())
-		}
+	// get game information for tonight, catching up has already polled today for last night's late games
+	tonight := []string{dateToday, dateTomorrow}
 
-		err = updateLeaderboard(config.Config.Rapid.Season)
+	if backfillErr == nil && len(dates) > 0 && dates[len(dates)-1] == dateToday {
+		tonight = tonight[1:]
+	}
 
-		if err != nil {
-			log.Error(err.Error())
-		}
+	if err := pollGames(tonight...); err != nil {
+		return err
 	}
 
 	// create a report for the upcoming matches tonight
-	_, err = createGameDayReport(dateToday)
-
-	if err != nil {
-		log.Error(err.Error())
+	if _, err := createGameDayReport(dateToday); err != nil {
+		return err
 	}
+
+	return backfillErr
 }
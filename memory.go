@@ -0,0 +1,616 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type (
+	// Store kept entirely in memory, used by the tests so they don't need a database
+	memoryStore struct {
+		mu          sync.Mutex
+		leaseMu     sync.Mutex // held from checking a lease to saving it, so only one caller can take it
+		collections map[string]*memoryCollection
+		lastUserID  int64
+	}
+
+	// documents are kept bson encoded so that callers never share maps/slices with the store, just like with mongo
+	memoryCollection struct {
+		keys []interface{} // insertion order
+		docs map[interface{}][]byte
+	}
+
+	pickKey struct {
+		UserID    int64
+		GameDayID string
+		SeasonID  string
+	}
+)
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		collections: make(map[string]*memoryCollection),
+	}
+}
+
+func (s *memoryStore) FindMatchByID(id int64) (*game, error) {
+	var game game
+	err := s.load(gamesCollection, id, &game)
+
+	return &game, err
+}
+
+func (s *memoryStore) FindMatchesByGameDateID(gameDateID string) ([]game, error) {
+	var games []game
+	err := s.each(gamesCollection, func(raw []byte) error {
+		var game game
+		if err := bson.Unmarshal(raw, &game); err != nil {
+			return err
+		}
+
+		if game.GameDayID == gameDateID {
+			games = append(games, game)
+		}
+
+		return nil
+	})
+
+	sortGames(games)
+
+	return games, err
+}
+
+func (s *memoryStore) FindMatchesBySeasonID(seasonID string, filters ...filter) ([]game, error) {
+	filters = append(filters, filter{"seasonId": seasonID})
+
+	var games []game
+	err := s.each(gamesCollection, func(raw []byte) error {
+		if !matchesFilters(raw, filters) {
+			return nil
+		}
+
+		var game game
+		if err := bson.Unmarshal(raw, &game); err != nil {
+			return err
+		}
+
+		games = append(games, game)
+		return nil
+	})
+
+	sortGames(games)
+
+	return games, err
+}
+
+func (s *memoryStore) UpsertMatch(game game) error {
+	return s.save(gamesCollection, game.ID, game)
+}
+
+func (s *memoryStore) UpsertMatches(games []game) error {
+	for _, game := range games {
+		if err := s.UpsertMatch(game); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) FindGameDayReportByID(id string) (*gameDayReport, error) {
+	var report gameDayReport
+	err := s.load(gameDaysCollection, id, &report)
+
+	return &report, err
+}
+
+func (s *memoryStore) UpsertGameDayReport(report gameDayReport) error {
+	return s.save(gameDaysCollection, report.ID, report)
+}
+
+func (s *memoryStore) FindPickReportsByGameDayID(date string, filters ...filter) ([]gameDayPicks, error) {
+	filters = append(filters, filter{"gameDayId": date})
+
+	var picks []gameDayPicks
+	err := s.each(picksCollection, func(raw []byte) error {
+		if !matchesFilters(raw, filters) {
+			return nil
+		}
+
+		var p gameDayPicks
+		if err := bson.Unmarshal(raw, &p); err != nil {
+			return err
+		}
+
+		picks = append(picks, p)
+		return nil
+	})
+
+	return picks, err
+}
+
+func (s *memoryStore) UpsertGameDayPicks(picks gameDayPicks) error {
+	key := pickKey{picks.UserID, picks.GameDayID, picks.SeasonID}
+
+	// keep the id of the existing document, as mongo's $set would
+	var existing gameDayPicks
+	if err := s.load(picksCollection, key, &existing); err == nil {
+		picks.ID = existing.ID
+	} else {
+		picks.ID = primitive.NewObjectID()
+	}
+
+	return s.save(picksCollection, key, picks)
+}
+
+func (s *memoryStore) AggregateUserScoresForSeason(season string) ([]userScoreOutput, error) {
+	scores := make(map[int64]int64)
+
+	err := s.each(picksCollection, func(raw []byte) error {
+		var p gameDayPicks
+		if err := bson.Unmarshal(raw, &p); err != nil {
+			return err
+		}
+
+		if p.SeasonID == season {
+			scores[p.UserID] += p.Score
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var out []userScoreOutput
+	for userID, score := range scores {
+		out = append(out, userScoreOutput{
+			ID:    userID,
+			Score: score,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score == out[j].Score {
+			return out[i].ID < out[j].ID
+		}
+
+		return out[i].Score > out[j].Score
+	})
+
+	return out, nil
+}
+
+func (s *memoryStore) FindGameDayResultsReportByID(id string) (*gameDayResults, error) {
+	var results gameDayResults
+	err := s.load(gameDayResultsCollection, id, &results)
+
+	return &results, err
+}
+
+func (s *memoryStore) UpsertGameDayResults(date string, results []result) error {
+	return s.save(gameDayResultsCollection, date, gameDayResults{
+		ID:         date,
+		UserScores: results,
+	})
+}
+
+func (s *memoryStore) FindLeaderboardByID(id string) (*leaderboard, error) {
+	var leaderboard leaderboard
+	err := s.load(leaderboardCollection, id, &leaderboard)
+
+	return &leaderboard, err
+}
+
+func (s *memoryStore) UpsertLeaderboard(leaderboard leaderboard) error {
+	return s.save(leaderboardCollection, leaderboard.ID, leaderboard)
+}
+
+func (s *memoryStore) FindSeasonByID(id string) (*season, error) {
+	var season season
+	err := s.load(seasonsCollection, id, &season)
+
+	return &season, err
+}
+
+func (s *memoryStore) UpsertSeason(season season) error {
+	return s.save(seasonsCollection, season.ID, season)
+}
+
+func (s *memoryStore) FindUserByID(id int64) (*user, error) {
+	var user user
+	err := s.load(usersCollection, id, &user)
+
+	return &user, err
+}
+
+func (s *memoryStore) FindUserByUsername(username string) (*user, error) {
+	users, err := s.findUsers(func(u user) bool {
+		return u.Username == username
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return &user{}, errNotFound
+	}
+
+	return &users[0], nil
+}
+
+func (s *memoryStore) FindUsersByIDs(ids []int64) ([]user, error) {
+	wanted := make(map[int64]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	return s.findUsers(func(u user) bool {
+		return wanted[u.ID]
+	})
+}
+
+func (s *memoryStore) InsertUser(user user) (*user, error) {
+	if _, err := s.FindUserByUsername(user.Username); err == nil {
+		return nil, errUsernameTaken
+	}
+
+	s.mu.Lock()
+	s.lastUserID++
+	user.ID = s.lastUserID
+	s.mu.Unlock()
+
+	return &user, s.save(usersCollection, user.ID, user)
+}
+
+func (s *memoryStore) FindLeagueByID(id string) (*league, error) {
+	var league league
+	err := s.load(leaguesCollection, id, &league)
+
+	return &league, err
+}
+
+func (s *memoryStore) FindLeagueByInviteCode(code string) (*league, error) {
+	leagues, err := s.findLeagues(func(l league) bool {
+		return l.InviteCode == code
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(leagues) == 0 {
+		return &league{}, errNotFound
+	}
+
+	return &leagues[0], nil
+}
+
+func (s *memoryStore) FindLeaguesByMember(userID int64) ([]league, error) {
+	return s.findLeagues(func(l league) bool {
+		for _, member := range l.Members {
+			if member == userID {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+func (s *memoryStore) InsertLeague(league league) error {
+	if _, err := s.FindLeagueByID(league.ID); err == nil {
+		return errLeagueExists
+	}
+
+	if _, err := s.FindLeagueByInviteCode(league.InviteCode); err == nil {
+		return errLeagueExists
+	}
+
+	return s.save(leaguesCollection, league.ID, league)
+}
+
+func (s *memoryStore) AddLeagueMember(leagueID string, userID int64) error {
+	league, err := s.FindLeagueByID(leagueID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, member := range league.Members {
+		if member == userID {
+			return nil
+		}
+	}
+
+	league.Members = append(league.Members, userID)
+	return s.save(leaguesCollection, league.ID, league)
+}
+
+func (s *memoryStore) FindSurvivorEntry(seasonID string, userID int64) (*survivorEntry, error) {
+	var entry survivorEntry
+	err := s.load(survivorCollection, survivorEntryID(seasonID, userID), &entry)
+
+	return &entry, err
+}
+
+func (s *memoryStore) FindSurvivorEntriesBySeasonID(seasonID string) ([]survivorEntry, error) {
+	var entries []survivorEntry
+	err := s.each(survivorCollection, func(raw []byte) error {
+		var entry survivorEntry
+		if err := bson.Unmarshal(raw, &entry); err != nil {
+			return err
+		}
+
+		if entry.SeasonID == seasonID {
+			entries = append(entries, entry)
+		}
+
+		return nil
+	})
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].UserID < entries[j].UserID
+	})
+
+	return entries, err
+}
+
+func (s *memoryStore) UpsertSurvivorEntry(entry survivorEntry) error {
+	return s.save(survivorCollection, entry.ID, entry)
+}
+
+func (s *memoryStore) FindBracketBySeasonID(seasonID string) (*bracket, error) {
+	var bracket bracket
+	err := s.load(bracketsCollection, seasonID, &bracket)
+
+	return &bracket, err
+}
+
+func (s *memoryStore) UpsertBracket(bracket bracket) error {
+	return s.save(bracketsCollection, bracket.ID, bracket)
+}
+
+func (s *memoryStore) FindBracketEntry(seasonID string, userID int64) (*bracketEntry, error) {
+	var entry bracketEntry
+	err := s.load(bracketEntriesCollection, bracketEntryID(seasonID, userID), &entry)
+
+	return &entry, err
+}
+
+func (s *memoryStore) FindBracketEntriesBySeasonID(seasonID string) ([]bracketEntry, error) {
+	var entries []bracketEntry
+	err := s.each(bracketEntriesCollection, func(raw []byte) error {
+		var entry bracketEntry
+		if err := bson.Unmarshal(raw, &entry); err != nil {
+			return err
+		}
+
+		if entry.SeasonID == seasonID {
+			entries = append(entries, entry)
+		}
+
+		return nil
+	})
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].UserID < entries[j].UserID
+	})
+
+	return entries, err
+}
+
+func (s *memoryStore) UpsertBracketEntry(entry bracketEntry) error {
+	return s.save(bracketEntriesCollection, entry.ID, entry)
+}
+
+func (s *memoryStore) FindAPIUsage(day string) (*apiUsage, error) {
+	var usage apiUsage
+	err := s.load(apiUsageCollection, day, &usage)
+
+	return &usage, err
+}
+
+func (s *memoryStore) UpsertAPIUsage(usage apiUsage) error {
+	return s.save(apiUsageCollection, usage.ID, usage)
+}
+
+func (s *memoryStore) FindAPIResponse(date string) (*apiResponse, error) {
+	var response apiResponse
+	err := s.load(apiResponsesCollection, date, &response)
+
+	return &response, err
+}
+
+func (s *memoryStore) UpsertAPIResponse(response apiResponse) error {
+	return s.save(apiResponsesCollection, response.ID, response)
+}
+
+func (s *memoryStore) UpsertJobRun(run jobRun) error {
+	return s.save(jobRunsCollection, run.ID, run)
+}
+
+func (s *memoryStore) FindRecentJobRuns(limit int) ([]jobRun, error) {
+	var runs []jobRun
+	err := s.each(jobRunsCollection, func(raw []byte) error {
+		var run jobRun
+		if err := bson.Unmarshal(raw, &run); err != nil {
+			return err
+		}
+
+		runs = append(runs, run)
+		return nil
+	})
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return runs, err
+}
+
+func (s *memoryStore) AcquireLease(next lease) (bool, error) {
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+
+	var current lease
+	err := s.load(leasesCollection, next.ID, &current)
+
+	if err != nil && err != errNotFound {
+		return false, err
+	}
+
+	if err == nil && current.Holder != next.Holder && current.ExpiresAt.After(next.RenewedAt) {
+		return false, nil
+	}
+
+	return true, s.save(leasesCollection, next.ID, next)
+}
+
+func (s *memoryStore) FindLease(id string) (*lease, error) {
+	var lease lease
+	err := s.load(leasesCollection, id, &lease)
+
+	return &lease, err
+}
+
+func (s *memoryStore) findLeagues(match func(league) bool) ([]league, error) {
+	var leagues []league
+	err := s.each(leaguesCollection, func(raw []byte) error {
+		var l league
+		if err := bson.Unmarshal(raw, &l); err != nil {
+			return err
+		}
+
+		if match(l) {
+			leagues = append(leagues, l)
+		}
+
+		return nil
+	})
+
+	return leagues, err
+}
+
+func (s *memoryStore) findUsers(match func(user) bool) ([]user, error) {
+	var users []user
+	err := s.each(usersCollection, func(raw []byte) error {
+		var u user
+		if err := bson.Unmarshal(raw, &u); err != nil {
+			return err
+		}
+
+		if match(u) {
+			users = append(users, u)
+		}
+
+		return nil
+	})
+
+	return users, err
+}
+
+func (s *memoryStore) save(collection string, key interface{}, doc interface{}) error {
+	raw, err := bson.Marshal(doc)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.collection(collection)
+
+	if _, ok := c.docs[key]; !ok {
+		c.keys = append(c.keys, key)
+	}
+
+	c.docs[key] = raw
+	return nil
+}
+
+func (s *memoryStore) load(collection string, key interface{}, out interface{}) error {
+	s.mu.Lock()
+	raw, ok := s.collection(collection).docs[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return errNotFound
+	}
+
+	return bson.Unmarshal(raw, out)
+}
+
+// calls fn with every document in the collection, in the order they were first saved
+func (s *memoryStore) each(collection string, fn func(raw []byte) error) error {
+	s.mu.Lock()
+	c := s.collection(collection)
+
+	docs := make([][]byte, 0, len(c.keys))
+	for _, key := range c.keys {
+		docs = append(docs, c.docs[key])
+	}
+	s.mu.Unlock()
+
+	for _, raw := range docs {
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// must be called with the lock held
+func (s *memoryStore) collection(name string) *memoryCollection {
+	c, ok := s.collections[name]
+
+	if !ok {
+		c = &memoryCollection{
+			docs: make(map[interface{}][]byte),
+		}
+
+		s.collections[name] = c
+	}
+
+	return c
+}
+
+// orders games by when they start, as the other stores do
+func sortGames(games []game) {
+	sort.SliceStable(games, func(i, j int) bool {
+		if games[i].StartDate.Equal(games[j].StartDate) {
+			return games[i].ID < games[j].ID
+		}
+
+		return games[i].StartDate.Before(games[j].StartDate)
+	})
+}
+
+// compares the top level fields of the document against the filters, like a simple mongo query
+func matchesFilters(raw []byte, filters []filter) bool {
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return false
+	}
+
+	for _, f := range filters {
+		for k, v := range f {
+			if doc[k] != v {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -2,138 +2,75 @@ package main
 
 import (
 	"context"
-	"nba-pick-and-play/config"
-	"time"
+	"errors"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/x/bsonx"
 )
 
 type (
-	game struct {
-		ID          int64     `bson:"_id" json:"id"`
-		SeasonID    string    `bson:"seasonId" json:"seasonId"`
-		Status      string    `bson:"status" json:"status"`
-		GameDayID   string    `bson:"gameDayId" json:"gameDayId"` // simple "YYYY-MM-DD" to determine the game's actual date (UTC != PST)
-		SeasonStage string    `bson:"seasonStage" json:"seasonStage"`
-		StartDate   time.Time `bson:"startDate" json:"startDate"` // UTC
-		WinnerID    int64     `bson:"winnerId" json:"winnerId"`   // id of the winning team
-		HomeTeam    team      `bson:"homeTeam" json:"homeTeam"`
-		AwayTeam    team      `bson:"awayTeam" json:"awayTeam"`
-		Venue       venue     `bson:"venue" json:"venue"`
+	mongoStore struct {
+		client *mongo.Client
+		name   string
 	}
 
-	team struct {
-		ID       int64  `bson:"id" json:"id"`
-		Name     string `bson:"name" json:"name"`
-		Nickname string `bson:"nickname" json:"nickname"`
-		Logo     string `bson:"logo" json:"logo"`
-		Score    int64  `bson:"score" json:"score"`
+	counter struct {
+		ID  string `bson:"_id"`
+		Seq int64  `bson:"seq"`
 	}
-
-	venue struct {
-		Name    string `bson:"name" json:"name"`
-		City    string `bson:"city" json:"city"`
-		Country string `bson:"country" json:"country"`
-	}
-
-	gameDayReport struct {
-		ID        string               `bson:"_id" json:"id"`
-		Games     map[int64]gameReport `bson:"games" json:"games"`
-		Deadline  time.Time            `bson:"deadline" json:"deadline"`
-		Evaluated bool                 `bson:"evaluated" json:"evaluated"`
-	}
-
-	gameReport struct {
-		HomeTeam team      `bson:"homeTeam" json:"homeTeam"`
-		AwayTeam team      `bson:"awayTeam" json:"awayTeam"`
-		Venue    venue     `bson:"venue" json:"venue"`
-		Date     time.Time `bson:"date" json:"date"`
-		WinnerID int64     `bson:"winnerId" json:"winnerId,omitempty"`
-	}
-
-	gameDayPicks struct {
-		ID        primitive.ObjectID `bson:"_id" json:"id"`
-		UserID    int64              `bson:"userId" json:"userId"`
-		SeasonID  string             `bson:"seasonId" json:"seasonId"`
-		GameDayID string             `bson:"gameDayId" json:"gameDayId"`
-		Picks     map[int64]pick     `bson:"picks" json:"picks"`
-		Evaluated bool               `bson:"evaluated" json:"evaluated"`
-		Score     int64              `bson:"score" json:"score"`
-		Date      time.Time          `bson:"date" json:"date"`
-	}
-
-	pick struct {
-		SelectionID int64  `bson:"selectionId" json:"selectionId"`
-		Status      string `bson:"status" json:"status"`
-	}
-
-	gameDayResults struct {
-		ID         string   `bson:"_id" json:"id"`
-		UserScores []result `bson:"scores" json:"scores"`
-	}
-
-	leaderboard struct {
-		ID                   string            `bson:"_id" json:"id"` // the specific season
-		Standings            []leaderboardUser `bson:"standings" json:"standings"`
-		LastGameDayEvaluated string            `bson:"lastGameDay" json:"lastGameDay"`
-	}
-
-	leaderboardUser struct {
-		UserID int64 `bson:"userId" json:"userId"`
-		Score  int64 `bson:"score" json:"score"`
-	}
-
-	userScoreOutput struct {
-		ID    int64 `bson:"_id" json:"id"`
-		Score int64 `bson:"score" json:"score"`
-	}
-
-	filter bson.M
 )
 
 const (
+	apiResponsesCollection   = "apiResponses"
+	apiUsageCollection       = "apiUsage"
+	bracketsCollection       = "brackets"
+	bracketEntriesCollection = "bracketEntries"
+	countersCollection       = "counters"
 	gameDaysCollection       = "gameDays"
 	gameDayResultsCollection = "gameDayResults"
 	gamesCollection          = "games"
+	jobRunsCollection        = "jobRuns"
 	leaderboardCollection    = "leaderboards"
+	leaguesCollection        = "leagues"
+	leasesCollection         = "leases"
 	picksCollection          = "picks"
+	seasonsCollection        = "seasons"
+	survivorCollection       = "survivor"
+	usersCollection          = "users"
 )
 
-var (
-	mongoClient *mongo.Client
-)
-
-func setupDatabase() {
-	clientOptions := options.Client().ApplyURI(config.Config.Mongo.HostURI)
+func newMongoStore(hostURI string, name string) (*mongoStore, error) {
+	clientOptions := options.Client().ApplyURI(hostURI)
 	client, err := mongo.NewClient(clientOptions)
 
 	if err != nil {
-		log.Fatalf("couldn't connect to mongo: %s", err.Error())
+		return nil, err
 	}
 
 	err = client.Connect(context.Background())
 
 	if err != nil {
-		log.Fatalf("couldn't connect with client: %s", err.Error())
+		return nil, err
 	}
 
-	mongoClient = client
+	store := &mongoStore{
+		client: client,
+		name:   name,
+	}
 
-	err = createIndexes()
+	err = store.createIndexes()
 
 	if err != nil {
-		log.Fatalf("couldn't create indexes: %s", err.Error())
+		return nil, err
 	}
 
-	log.Println("connected to mongodb")
+	return store, nil
 }
 
-func createIndexes() error {
-	db := getDatabase()
+func (s *mongoStore) createIndexes() error {
+	db := s.database()
 
 	_, err := db.Collection(gamesCollection).Indexes().CreateOne(
 		context.Background(),
@@ -145,18 +82,82 @@ func createIndexes() error {
 		},
 	)
 
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection(gamesCollection).Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bsonx.Doc{
+				{"seasonId", bsonx.Int32(1)},
+			},
+			Options: options.Index().SetName("seasonIdIndex").SetBackground(true),
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection(usersCollection).Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bsonx.Doc{
+				{"username", bsonx.Int32(1)},
+			},
+			Options: options.Index().SetName("usernameIndex").SetUnique(true).SetBackground(true),
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection(leaguesCollection).Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bsonx.Doc{
+					{"inviteCode", bsonx.Int32(1)},
+				},
+				Options: options.Index().SetName("inviteCodeIndex").SetUnique(true).SetBackground(true),
+			},
+			{
+				Keys: bsonx.Doc{
+					{"members", bsonx.Int32(1)},
+				},
+				Options: options.Index().SetName("membersIndex").SetBackground(true),
+			},
+		},
+	)
+
 	return err
 }
 
-func findMatchesByGameDateID(gameDateID string) ([]game, error) {
-	db := getDatabase()
+func (s *mongoStore) FindMatchByID(id int64) (*game, error) {
+	db := s.database()
+
+	var game game
+	err := db.Collection(gamesCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"_id", id},
+		},
+	).Decode(&game)
+
+	return &game, notFound(err)
+}
+
+func (s *mongoStore) FindMatchesByGameDateID(gameDateID string) ([]game, error) {
+	db := s.database()
 
 	filter := bson.D{
 		{"gameDayId", gameDateID},
 	}
 
 	options := options.FindOptions{}
-	options.SetSort(bson.D{{"startDateUTC", 1}})
+	options.SetSort(bson.D{{"startDate", 1}, {"_id", 1}})
 
 	cur, err := db.Collection(gamesCollection).Find(
 		context.Background(),
@@ -174,8 +175,37 @@ func findMatchesByGameDateID(gameDateID string) ([]game, error) {
 	return games, err
 }
 
-func findGameDayReportByID(id string) (*gameDayReport, error) {
-	db := getDatabase()
+func (s *mongoStore) FindMatchesBySeasonID(seasonID string, filters ...filter) ([]game, error) {
+	db := s.database()
+
+	queryFilters := bson.M{}
+	queryFilters["seasonId"] = seasonID
+
+	for _, filter := range filters {
+		addFilter(queryFilters, filter)
+	}
+
+	options := options.FindOptions{}
+	options.SetSort(bson.D{{"startDate", 1}, {"_id", 1}})
+
+	cur, err := db.Collection(gamesCollection).Find(
+		context.Background(),
+		queryFilters,
+		&options,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var games []game
+	err = cur.All(context.Background(), &games)
+
+	return games, err
+}
+
+func (s *mongoStore) FindGameDayReportByID(id string) (*gameDayReport, error) {
+	db := s.database()
 
 	var report gameDayReport
 	err := db.Collection(gameDaysCollection).FindOne(
@@ -185,11 +215,11 @@ func findGameDayReportByID(id string) (*gameDayReport, error) {
 		},
 	).Decode(&report)
 
-	return &report, err
+	return &report, notFound(err)
 }
 
-func findGameDayResultsReportByID(id string) (*gameDayResults, error) {
-	db := getDatabase()
+func (s *mongoStore) FindGameDayResultsReportByID(id string) (*gameDayResults, error) {
+	db := s.database()
 
 	var results gameDayResults
 	err := db.Collection(gameDayResultsCollection).FindOne(
@@ -199,11 +229,11 @@ func findGameDayResultsReportByID(id string) (*gameDayResults, error) {
 		},
 	).Decode(&results)
 
-	return &results, err
+	return &results, notFound(err)
 }
 
-func findLeaderboardByID(id string) (*leaderboard, error) {
-	db := getDatabase()
+func (s *mongoStore) FindLeaderboardByID(id string) (*leaderboard, error) {
+	db := s.database()
 
 	var leaderboard leaderboard
 	err := db.Collection(leaderboardCollection).FindOne(
@@ -213,11 +243,11 @@ func findLeaderboardByID(id string) (*leaderboard, error) {
 		},
 	).Decode(&leaderboard)
 
-	return &leaderboard, err
+	return &leaderboard, notFound(err)
 }
 
-func findPickReportsByGameDayID(date string, filters ...filter) ([]gameDayPicks, error) {
-	db := getDatabase()
+func (s *mongoStore) FindPickReportsByGameDayID(date string, filters ...filter) ([]gameDayPicks, error) {
+	db := s.database()
 
 	queryFilters := bson.M{}
 	queryFilters["gameDayId"] = date
@@ -241,12 +271,12 @@ func findPickReportsByGameDayID(date string, filters ...filter) ([]gameDayPicks,
 	return picks, err
 }
 
-func aggregateUserScoresForSeason(season string) ([]userScoreOutput, error) {
-	db := getDatabase()
+func (s *mongoStore) AggregateUserScoresForSeason(season string) ([]userScoreOutput, error) {
+	db := s.database()
 
 	matchStage := bson.D{{"$match", bson.D{{"seasonId", season}}}}
 	groupStage := bson.D{{"$group", bson.D{{"_id", "$userId"}, {"score", bson.D{{"$sum", "$score"}}}}}}
-	sortStage := bson.D{{"$sort", bson.D{{"score", -1}}}}
+	sortStage := bson.D{{"$sort", bson.D{{"score", -1}, {"_id", 1}}}}
 
 	cur, err := db.Collection(picksCollection).Aggregate(
 		context.Background(),
@@ -263,8 +293,508 @@ func aggregateUserScoresForSeason(season string) ([]userScoreOutput, error) {
 	return out, err
 }
 
-func upsertMatch(game game) error {
-	db := getDatabase()
+func (s *mongoStore) FindSeasonByID(id string) (*season, error) {
+	db := s.database()
+
+	var season season
+	err := db.Collection(seasonsCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"_id", id},
+		},
+	).Decode(&season)
+
+	return &season, notFound(err)
+}
+
+func (s *mongoStore) UpsertSeason(season season) error {
+	db := s.database()
+
+	options := options.ReplaceOptions{}
+	options.SetUpsert(true)
+
+	_, err := db.Collection(seasonsCollection).ReplaceOne(
+		context.Background(),
+		bson.D{
+			{"_id", season.ID},
+		},
+		season,
+		&options,
+	)
+
+	return err
+}
+
+func (s *mongoStore) FindUserByID(id int64) (*user, error) {
+	db := s.database()
+
+	var user user
+	err := db.Collection(usersCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"_id", id},
+		},
+	).Decode(&user)
+
+	return &user, notFound(err)
+}
+
+func (s *mongoStore) FindUserByUsername(username string) (*user, error) {
+	db := s.database()
+
+	var user user
+	err := db.Collection(usersCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"username", username},
+		},
+	).Decode(&user)
+
+	return &user, notFound(err)
+}
+
+func (s *mongoStore) FindUsersByIDs(ids []int64) ([]user, error) {
+	db := s.database()
+
+	cur, err := db.Collection(usersCollection).Find(
+		context.Background(),
+		bson.D{
+			{"_id", bson.D{{"$in", ids}}},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var users []user
+	err = cur.All(context.Background(), &users)
+
+	return users, err
+}
+
+// inserts a new user, assigning it the next available user id
+func (s *mongoStore) InsertUser(user user) (*user, error) {
+	id, err := s.nextSequence(usersCollection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	user.ID = id
+
+	db := s.database()
+	_, err = db.Collection(usersCollection).InsertOne(context.Background(), user)
+
+	if isDuplicateKeyError(err) {
+		return nil, errUsernameTaken
+	}
+
+	return &user, err
+}
+
+// mongo has no auto-incrementing ids, so keep a counter document per collection
+func (s *mongoStore) nextSequence(name string) (int64, error) {
+	db := s.database()
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter counter
+	err := db.Collection(countersCollection).FindOneAndUpdate(
+		context.Background(),
+		bson.D{
+			{"_id", name},
+		},
+		bson.D{
+			{"$inc", bson.D{{"seq", int64(1)}}},
+		},
+		opts,
+	).Decode(&counter)
+
+	return counter.Seq, err
+}
+
+func (s *mongoStore) FindLeagueByID(id string) (*league, error) {
+	return s.findLeague(bson.D{{"_id", id}})
+}
+
+func (s *mongoStore) FindLeagueByInviteCode(code string) (*league, error) {
+	return s.findLeague(bson.D{{"inviteCode", code}})
+}
+
+func (s *mongoStore) findLeague(filter bson.D) (*league, error) {
+	db := s.database()
+
+	var league league
+	err := db.Collection(leaguesCollection).FindOne(
+		context.Background(),
+		filter,
+	).Decode(&league)
+
+	return &league, notFound(err)
+}
+
+func (s *mongoStore) FindLeaguesByMember(userID int64) ([]league, error) {
+	db := s.database()
+
+	options := options.FindOptions{}
+	options.SetSort(bson.D{{"createdAt", 1}, {"_id", 1}})
+
+	cur, err := db.Collection(leaguesCollection).Find(
+		context.Background(),
+		bson.D{
+			{"members", userID},
+		},
+		&options,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var leagues []league
+	err = cur.All(context.Background(), &leagues)
+
+	return leagues, err
+}
+
+func (s *mongoStore) InsertLeague(league league) error {
+	db := s.database()
+
+	_, err := db.Collection(leaguesCollection).InsertOne(context.Background(), league)
+
+	if isDuplicateKeyError(err) {
+		return errLeagueExists
+	}
+
+	return err
+}
+
+func (s *mongoStore) AddLeagueMember(leagueID string, userID int64) error {
+	db := s.database()
+
+	result, err := db.Collection(leaguesCollection).UpdateOne(
+		context.Background(),
+		bson.D{
+			{"_id", leagueID},
+		},
+		bson.D{
+			{"$addToSet", bson.D{{"members", userID}}},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errNotFound
+	}
+
+	return nil
+}
+
+func (s *mongoStore) FindSurvivorEntry(seasonID string, userID int64) (*survivorEntry, error) {
+	db := s.database()
+
+	var entry survivorEntry
+	err := db.Collection(survivorCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"_id", survivorEntryID(seasonID, userID)},
+		},
+	).Decode(&entry)
+
+	return &entry, notFound(err)
+}
+
+func (s *mongoStore) FindSurvivorEntriesBySeasonID(seasonID string) ([]survivorEntry, error) {
+	db := s.database()
+
+	options := options.FindOptions{}
+	options.SetSort(bson.D{{"userId", 1}})
+
+	cur, err := db.Collection(survivorCollection).Find(
+		context.Background(),
+		bson.D{
+			{"seasonId", seasonID},
+		},
+		&options,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []survivorEntry
+	err = cur.All(context.Background(), &entries)
+
+	return entries, err
+}
+
+func (s *mongoStore) UpsertSurvivorEntry(entry survivorEntry) error {
+	db := s.database()
+
+	options := options.ReplaceOptions{}
+	options.SetUpsert(true)
+
+	_, err := db.Collection(survivorCollection).ReplaceOne(
+		context.Background(),
+		bson.D{
+			{"_id", entry.ID},
+		},
+		entry,
+		&options,
+	)
+
+	return err
+}
+
+func (s *mongoStore) FindBracketBySeasonID(seasonID string) (*bracket, error) {
+	db := s.database()
+
+	var bracket bracket
+	err := db.Collection(bracketsCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"_id", seasonID},
+		},
+	).Decode(&bracket)
+
+	return &bracket, notFound(err)
+}
+
+func (s *mongoStore) UpsertBracket(bracket bracket) error {
+	db := s.database()
+
+	options := options.ReplaceOptions{}
+	options.SetUpsert(true)
+
+	_, err := db.Collection(bracketsCollection).ReplaceOne(
+		context.Background(),
+		bson.D{
+			{"_id", bracket.ID},
+		},
+		bracket,
+		&options,
+	)
+
+	return err
+}
+
+func (s *mongoStore) FindBracketEntry(seasonID string, userID int64) (*bracketEntry, error) {
+	db := s.database()
+
+	var entry bracketEntry
+	err := db.Collection(bracketEntriesCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"_id", bracketEntryID(seasonID, userID)},
+		},
+	).Decode(&entry)
+
+	return &entry, notFound(err)
+}
+
+func (s *mongoStore) FindBracketEntriesBySeasonID(seasonID string) ([]bracketEntry, error) {
+	db := s.database()
+
+	options := options.FindOptions{}
+	options.SetSort(bson.D{{"userId", 1}})
+
+	cur, err := db.Collection(bracketEntriesCollection).Find(
+		context.Background(),
+		bson.D{
+			{"seasonId", seasonID},
+		},
+		&options,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []bracketEntry
+	err = cur.All(context.Background(), &entries)
+
+	return entries, err
+}
+
+func (s *mongoStore) UpsertBracketEntry(entry bracketEntry) error {
+	db := s.database()
+
+	options := options.ReplaceOptions{}
+	options.SetUpsert(true)
+
+	_, err := db.Collection(bracketEntriesCollection).ReplaceOne(
+		context.Background(),
+		bson.D{
+			{"_id", entry.ID},
+		},
+		entry,
+		&options,
+	)
+
+	return err
+}
+
+func (s *mongoStore) FindAPIUsage(day string) (*apiUsage, error) {
+	db := s.database()
+
+	var usage apiUsage
+	err := db.Collection(apiUsageCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"_id", day},
+		},
+	).Decode(&usage)
+
+	return &usage, notFound(err)
+}
+
+func (s *mongoStore) UpsertAPIUsage(usage apiUsage) error {
+	db := s.database()
+
+	options := options.ReplaceOptions{}
+	options.SetUpsert(true)
+
+	_, err := db.Collection(apiUsageCollection).ReplaceOne(
+		context.Background(),
+		bson.D{
+			{"_id", usage.ID},
+		},
+		usage,
+		&options,
+	)
+
+	return err
+}
+
+func (s *mongoStore) FindAPIResponse(date string) (*apiResponse, error) {
+	db := s.database()
+
+	var response apiResponse
+	err := db.Collection(apiResponsesCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"_id", date},
+		},
+	).Decode(&response)
+
+	return &response, notFound(err)
+}
+
+func (s *mongoStore) UpsertAPIResponse(response apiResponse) error {
+	db := s.database()
+
+	options := options.ReplaceOptions{}
+	options.SetUpsert(true)
+
+	_, err := db.Collection(apiResponsesCollection).ReplaceOne(
+		context.Background(),
+		bson.D{
+			{"_id", response.ID},
+		},
+		response,
+		&options,
+	)
+
+	return err
+}
+
+func (s *mongoStore) UpsertJobRun(run jobRun) error {
+	db := s.database()
+
+	options := options.ReplaceOptions{}
+	options.SetUpsert(true)
+
+	_, err := db.Collection(jobRunsCollection).ReplaceOne(
+		context.Background(),
+		bson.D{
+			{"_id", run.ID},
+		},
+		run,
+		&options,
+	)
+
+	return err
+}
+
+func (s *mongoStore) FindRecentJobRuns(limit int) ([]jobRun, error) {
+	db := s.database()
+
+	options := options.FindOptions{}
+	options.SetSort(bson.D{{"startedAt", -1}})
+	options.SetLimit(int64(limit))
+
+	cur, err := db.Collection(jobRunsCollection).Find(
+		context.Background(),
+		bson.D{},
+		&options,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []jobRun
+	err = cur.All(context.Background(), &runs)
+
+	return runs, err
+}
+
+/*
+	The lease is only matched when it's free to take, so when another instance holds it the upsert tries to insert a
+	second document with the same id, which the unique _id index turns away.
+*/
+func (s *mongoStore) AcquireLease(lease lease) (bool, error) {
+	db := s.database()
+
+	options := options.UpdateOptions{}
+	options.SetUpsert(true)
+
+	_, err := db.Collection(leasesCollection).UpdateOne(
+		context.Background(),
+		bson.D{
+			{"_id", lease.ID},
+			{"$or", bson.A{
+				bson.D{{"expiresAt", bson.D{{"$lte", lease.RenewedAt}}}},
+				bson.D{{"holder", lease.Holder}},
+			}},
+		},
+		bson.D{
+			{"$set", bson.D{
+				{"holder", lease.Holder},
+				{"renewedAt", lease.RenewedAt},
+				{"expiresAt", lease.ExpiresAt},
+			}},
+		},
+		&options,
+	)
+
+	if isDuplicateKeyError(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *mongoStore) FindLease(id string) (*lease, error) {
+	db := s.database()
+
+	var lease lease
+	err := db.Collection(leasesCollection).FindOne(
+		context.Background(),
+		bson.D{
+			{"_id", id},
+		},
+	).Decode(&lease)
+
+	return &lease, notFound(err)
+}
+
+func (s *mongoStore) UpsertMatch(game game) error {
+	db := s.database()
 
 	options := options.ReplaceOptions{}
 	options.SetUpsert(true)
@@ -281,8 +811,28 @@ func upsertMatch(game game) error {
 	return err
 }
 
-func upsertGameDayPicks(picks gameDayPicks) error {
-	db := getDatabase()
+func (s *mongoStore) UpsertMatches(games []game) error {
+	if len(games) == 0 {
+		return nil // mongo refuses an empty bulk write
+	}
+
+	db := s.database()
+
+	var models []mongo.WriteModel
+	for _, game := range games {
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{"_id", game.ID}}).
+			SetReplacement(game).
+			SetUpsert(true))
+	}
+
+	_, err := db.Collection(gamesCollection).BulkWrite(context.Background(), models)
+
+	return err
+}
+
+func (s *mongoStore) UpsertGameDayPicks(picks gameDayPicks) error {
+	db := s.database()
 
 	options := options.UpdateOptions{}
 	options.SetUpsert(true)
@@ -308,8 +858,8 @@ func upsertGameDayPicks(picks gameDayPicks) error {
 	return err
 }
 
-func upsertGameDayReport(report gameDayReport) error {
-	db := getDatabase()
+func (s *mongoStore) UpsertGameDayReport(report gameDayReport) error {
+	db := s.database()
 
 	options := options.ReplaceOptions{}
 	options.SetUpsert(true)
@@ -326,8 +876,8 @@ func upsertGameDayReport(report gameDayReport) error {
 	return err
 }
 
-func upsertGameDayResults(date string, results []result) error {
-	db := getDatabase()
+func (s *mongoStore) UpsertGameDayResults(date string, results []result) error {
+	db := s.database()
 
 	options := options.UpdateOptions{}
 	options.SetUpsert(true)
@@ -348,8 +898,8 @@ func upsertGameDayResults(date string, results []result) error {
 	return err
 }
 
-func upsertLeaderboard(leaderboard leaderboard) error {
-	db := getDatabase()
+func (s *mongoStore) UpsertLeaderboard(leaderboard leaderboard) error {
+	db := s.database()
 
 	options := options.ReplaceOptions{}
 	options.SetUpsert(true)
@@ -366,12 +916,37 @@ func upsertLeaderboard(leaderboard leaderboard) error {
 	return err
 }
 
+func (s *mongoStore) database() *mongo.Database {
+	return s.client.Database(s.name)
+}
+
+// translates mongo's missing document error into the Store's own
+func notFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return errNotFound
+	}
+
+	return err
+}
+
+func isDuplicateKeyError(err error) bool {
+	var writeErr mongo.WriteException
+
+	if !errors.As(err, &writeErr) {
+		return false
+	}
+
+	for _, e := range writeErr.WriteErrors {
+		if e.Code == 11000 {
+			return true
+		}
+	}
+
+	return false
+}
+
 func addFilter(a bson.M, b filter) {
 	for k, v := range b {
 		a[k] = v
 	}
 }
-
-func getDatabase() *mongo.Database {
-	return mongoClient.Database(config.Config.Mongo.Name)
-}
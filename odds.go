@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"nba-pick-and-play/config"
+)
+
+var (
+	errInvalidOdds      = errors.New("invalid odds")
+	errGameDayEvaluated = errors.New("game day has already been evaluated")
+	errGameLocked       = errors.New("game has already locked")
+)
+
+// sets the odds for games on the game day, which decide the underdogs (instead of the teams' records) and the spreads picked against
+func importOdds(date string, gameOdds map[int64]odds) (*gameDayReport, error) {
+	report, err := store.FindGameDayReportByID(date)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if report.Evaluated {
+		return nil, errGameDayEvaluated
+	}
+
+	now := clock.Now()
+
+	for gameID, o := range gameOdds {
+		game, ok := report.Games[gameID]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: game with id %d is not being played on this game day", errInvalidOdds, gameID)
+		}
+
+		// picks may already have been made against the odds once the game locks
+		if game.isLocked(now) {
+			return nil, fmt.Errorf("%w: odds for game %d can no longer change", errGameLocked, gameID)
+		}
+
+		if err := validateOdds(o); err != nil {
+			return nil, fmt.Errorf("%w for game %d: %s", errInvalidOdds, gameID, err.Error())
+		}
+
+		setOdds(&game, o)
+		report.Games[gameID] = game
+	}
+
+	err = store.UpsertGameDayReport(*report)
+	return report, err
+}
+
+// moneylines are optional but must come as a pair, and there must be at least a pair or a spread
+func validateOdds(o odds) error {
+	if (o.HomeMoneyline == 0) != (o.AwayMoneyline == 0) {
+		return errors.New("both teams need a moneyline")
+	}
+
+	if o.HomeMoneyline == 0 && o.Spread == nil {
+		return errors.New("either moneylines or a spread is needed")
+	}
+
+	for _, moneyline := range []int64{o.HomeMoneyline, o.AwayMoneyline} {
+		if moneyline != 0 && moneyline > -100 && moneyline < 100 {
+			return errors.New("moneylines must be at most -100 or at least 100")
+		}
+	}
+
+	return nil
+}
+
+func setOdds(game *gameReport, o odds) {
+	game.Odds = &o
+	game.UnderdogID = findUnderdog(*game)
+}
+
+// reads the game day's odds from the configured odds file, if there is one
+func loadOddsFile(date string) (map[int64]odds, error) {
+	path := config.Config.Odds.File
+
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var file map[string]map[int64]odds // game day -> game id -> odds
+
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("could not read odds file %s: %w", path, err)
+	}
+
+	gameOdds := file[date]
+	for gameID, o := range gameOdds {
+		if err := validateOdds(o); err != nil {
+			return nil, fmt.Errorf("odds file %s has invalid odds for game %d: %s", path, gameID, err.Error())
+		}
+	}
+
+	return gameOdds, nil
+}
@@ -1,36 +1,64 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"time"
 )
 
-func evaluatePicks(report gameDayReport, date string) error {
-	pickReports, err := findPickReportsByGameDayID(date)
+const (
+	pickPending   = "PENDING"
+	pickCorrect   = "CORRECT"
+	pickIncorrect = "INCORRECT"
+	pickVoid      = "VOID" // the game had no winner, so the pick doesn't count either way
+)
+
+// evaluates every user's picks for the game day, returning how many were evaluated
+// picks which were already evaluated are scored again, so a corrected result (see adminOverrideGame) is picked up
+func evaluatePicks(report gameDayReport, date string) (int, error) {
+	pickReports, err := store.FindPickReportsByGameDayID(date)
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
+	evaluated := 0
 	for _, pickReport := range pickReports {
 		updatedPicksReport := evaluateUserPicks(report, pickReport)
-		upsertGameDayPicks(updatedPicksReport)
+
+		if err := store.UpsertGameDayPicks(updatedPicksReport); err != nil {
+			return evaluated, err
+		}
+
+		evaluated++
 	}
 
-	return nil
+	return evaluated, nil
 }
 
 func evaluateUserPicks(report gameDayReport, picksReport gameDayPicks) gameDayPicks {
-	if picksReport.Evaluated {
-		return picksReport
-	}
+	strategy := scoringStrategyFor(report)
 
 	var score int64
 	for gameID, pick := range picksReport.Picks {
-		if pick.SelectionID == report.Games[gameID].WinnerID {
-			pick.Status = "CORRECT"
-			score++
+		game := report.Games[gameID]
+		pick.Points = &points{}
+
+		winnerID := game.WinnerID
+		if report.PickType == pickTypeSpread {
+			winnerID = game.ATSWinnerID
+		}
+
+		if winnerID == 0 {
+			pick.Status = pickVoid
+		} else if pick.SelectionID == winnerID {
+			pick.Status = pickCorrect
+
+			earned := strategy.score(game, pick)
+			pick.Points = &earned
+			score += earned.Total
 		} else {
-			pick.Status = "INCORRECT"
+			pick.Status = pickIncorrect
 		}
 
 		picksReport.Picks[gameID] = pick
@@ -41,25 +69,78 @@ func evaluateUserPicks(report gameDayReport, picksReport gameDayPicks) gameDayPi
 	return picksReport
 }
 
-func verifyPicks(gameDate string, userPicks map[int64]int64) (map[int64]pick, error) {
+// a game locks once it tips off, or if it's no longer scheduled (e.g. postponed) regardless of the time
+func (g gameReport) isLocked(now time.Time) bool {
+	return !now.Before(g.LockTime) || (g.State != "" && g.State != stateScheduled)
+}
+
+// flags which of the games on the report can still be picked
+func markOpenGames(report *gameDayReport, now time.Time) {
+	for gameID, game := range report.Games {
+		game.Open = !game.isLocked(now)
+		report.Games[gameID] = game
+	}
+}
+
+// copies the latest state, scores, period and clock of each game onto the report, so it can be followed live
+func markLiveGames(report *gameDayReport, games []game) {
+	for _, game := range games {
+		gameReport, ok := report.Games[game.ID]
+
+		if !ok {
+			continue
+		}
+
+		gameReport.State = game.State
+		gameReport.HomeTeam.Score = game.HomeTeam.Score
+		gameReport.AwayTeam.Score = game.AwayTeam.Score
+		gameReport.Period = game.Period
+		gameReport.Clock = game.Clock
+
+		report.Games[game.ID] = gameReport
+	}
+}
+
+// checks the user's picks against the game day, keeping any picks they've already made on games which have locked
+func verifyPicks(userID int64, payload picksPayload) (map[int64]pick, error) {
 	// get the game day report
-	report, err := findGameDayReportByID(gameDate)
+	report, err := store.FindGameDayReportByID(payload.GameDayID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if report.Deadline.Before(clock.Now()) {
-		return nil, fmt.Errorf("missed deadline: %v", report.Deadline) // TODO: turn into error struct?
+	now := clock.Now()
+
+	existing, err := findUserPicks(payload.GameDayID, userID)
+
+	if err != nil {
+		return nil, err
 	}
 
-	// create a map with all possible picks
+	// create a map with all possible picks, carrying over the locked ones
 	picks := make(map[int64]pick)
-	for gameID := range report.Games {
-		picks[gameID] = pick{}
+	var lastLock time.Time
+	allLocked := true
+
+	for gameID, game := range report.Games {
+		if game.isLocked(now) {
+			picks[gameID] = existing[gameID]
+		} else {
+			picks[gameID] = pick{}
+			allLocked = false
+		}
+
+		if game.LockTime.After(lastLock) {
+			lastLock = game.LockTime
+		}
+	}
+
+	if allLocked {
+		return nil, fmt.Errorf("missed deadline: %v", lastLock) // TODO: turn into error struct?
 	}
 
-	for gameID, userPick := range userPicks {
+	for gameID, userPick := range payload.Picks {
 		_, ok := picks[gameID]
 
 		if !ok {
@@ -72,11 +153,100 @@ func verifyPicks(gameDate string, userPicks map[int64]int64) (map[int64]pick, er
 			return nil, fmt.Errorf("team %d is not playing in the game %d", userPick, gameID)
 		}
 
+		if report.PickType == pickTypeSpread && (game.Odds == nil || game.Odds.Spread == nil) {
+			return nil, fmt.Errorf("game %d has no spread yet", gameID)
+		}
+
+		if game.isLocked(now) {
+			// resubmitting an unchanged pick is fine, changing it isn't
+			if existing[gameID].SelectionID != userPick {
+				return nil, fmt.Errorf("game %d locked at %v", gameID, game.LockTime)
+			}
+
+			continue
+		}
+
 		picks[gameID] = pick{
 			SelectionID: userPick,
-			Status:      "PENDING",
+			Confidence:  payload.Confidence[gameID],
+			Status:      pickPending,
 		}
 	}
 
+	if report.Scoring != scoringConfidence {
+		if len(payload.Confidence) > 0 {
+			return nil, errors.New("confidence can only be given for confidence scored game days")
+		}
+
+		return picks, nil
+	}
+
+	if err := verifyConfidence(report, picks, payload.Confidence, now); err != nil {
+		return nil, err
+	}
+
 	return picks, nil
 }
+
+// every pick needs a confidence, and together they must rank the picks 1..N with no repeats
+func verifyConfidence(report *gameDayReport, picks map[int64]pick, confidence map[int64]int64, now time.Time) error {
+	for gameID, value := range confidence {
+		game, ok := report.Games[gameID]
+
+		if !ok {
+			return fmt.Errorf("game with id %d is not being played on this game day", gameID)
+		}
+
+		if game.isLocked(now) && picks[gameID].Confidence != value {
+			return fmt.Errorf("game %d locked at %v", gameID, game.LockTime)
+		}
+	}
+
+	seen := make(map[int64]int64) // confidence -> game id
+	picked := 0
+
+	for gameID, p := range picks {
+		if p.SelectionID == 0 {
+			if confidence[gameID] != 0 {
+				return fmt.Errorf("confidence given for game %d without a pick", gameID)
+			}
+
+			continue
+		}
+
+		picked++
+
+		if p.Confidence == 0 {
+			return fmt.Errorf("missing confidence for game %d", gameID)
+		}
+
+		if other, ok := seen[p.Confidence]; ok {
+			return fmt.Errorf("confidence %d used for more than one game (%d and %d)", p.Confidence, other, gameID)
+		}
+
+		seen[p.Confidence] = gameID
+	}
+
+	for gameID, p := range picks {
+		if p.SelectionID != 0 && (p.Confidence < 1 || p.Confidence > int64(picked)) {
+			return fmt.Errorf("confidence for game %d must be between 1 and %d", gameID, picked)
+		}
+	}
+
+	return nil
+}
+
+// the picks the user has already made for the game day, if any
+func findUserPicks(gameDate string, userID int64) (map[int64]pick, error) {
+	pickReports, err := store.FindPickReportsByGameDayID(gameDate, filter{"userId": userID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pickReports) == 0 {
+		return map[int64]pick{}, nil
+	}
+
+	return pickReports[0].Picks, nil
+}
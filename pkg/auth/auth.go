@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	//AccessToken type of token used to authenticate requests
+	AccessToken = "access"
+	//RefreshToken type of token used to obtain a new access token
+	RefreshToken = "refresh"
+)
+
+type (
+	//Claims the contents of a signed token
+	Claims struct {
+		UserID    int64  `json:"sub"`
+		Type      string `json:"typ"`
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+	}
+
+	//Signer issues and verifies HS256 signed JWTs
+	Signer struct {
+		secret []byte
+	}
+
+	header struct {
+		Algorithm string `json:"alg"`
+		Type      string `json:"typ"`
+	}
+)
+
+var (
+	//ErrMalformedToken the token could not be parsed
+	ErrMalformedToken = errors.New("malformed token")
+	//ErrInvalidSignature the token was not signed by this service
+	ErrInvalidSignature = errors.New("invalid token signature")
+	//ErrWrongTokenType e.g. a refresh token was used to authenticate a request
+	ErrWrongTokenType = errors.New("wrong token type")
+	//ErrExpiredToken the token is past its expiry
+	ErrExpiredToken = errors.New("token has expired")
+
+	encoding = base64.RawURLEncoding
+)
+
+//NewSigner returns a Signer using the given secret for the HMAC
+func NewSigner(secret string) *Signer {
+	return &Signer{
+		secret: []byte(secret),
+	}
+}
+
+//Issue creates a signed token for the user which expires after the ttl
+func (s *Signer) Issue(userID int64, tokenType string, issuedAt time.Time, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := issuedAt.Add(ttl)
+
+	headerJSON, err := json.Marshal(header{Algorithm: "HS256", Type: "JWT"})
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claimsJSON, err := json.Marshal(Claims{
+		UserID:    userID,
+		Type:      tokenType,
+		IssuedAt:  issuedAt.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := encoding.EncodeToString(headerJSON) + "." + encoding.EncodeToString(claimsJSON)
+
+	return unsigned + "." + encoding.EncodeToString(s.sign(unsigned)), expiresAt, nil
+}
+
+//Verify checks the token's signature, type and expiry, returning its claims
+func (s *Signer) Verify(token string, tokenType string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if !hmac.Equal(signature, s.sign(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidSignature
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil || h.Algorithm != "HS256" {
+		return nil, ErrMalformedToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if claims.Type != tokenType {
+		return nil, ErrWrongTokenType
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func (s *Signer) sign(unsigned string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(unsigned))
+
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := encoding.DecodeString(segment)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
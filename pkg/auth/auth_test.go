@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "test-secret-for-signing-test-tokens"
+
+var issuedAt = time.Date(2020, time.January, 18, 12, 0, 0, 0, time.UTC)
+
+func TestIssueAndVerify(t *testing.T) {
+	signer := NewSigner(testSecret)
+
+	token, expiresAt, err := signer.Issue(12345, AccessToken, issuedAt, 15*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, issuedAt.Add(15*time.Minute), expiresAt)
+	assert.Equal(t, 3, len(strings.Split(token, ".")))
+
+	claims, err := signer.Verify(token, AccessToken, issuedAt.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, &Claims{
+		UserID:    12345,
+		Type:      AccessToken,
+		IssuedAt:  issuedAt.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}, claims)
+}
+
+func TestVerifyRejects(t *testing.T) {
+	signer := NewSigner(testSecret)
+
+	access, _, err := signer.Issue(12345, AccessToken, issuedAt, 15*time.Minute)
+	assert.Nil(t, err)
+
+	refresh, _, err := signer.Issue(12345, RefreshToken, issuedAt, 24*time.Hour)
+	assert.Nil(t, err)
+
+	forged, _, err := NewSigner("some-other-secret-which-is-long-enough").Issue(12345, AccessToken, issuedAt, 15*time.Minute)
+	assert.Nil(t, err)
+
+	// the claims swapped for another user's, keeping the original signature
+	parts := strings.Split(access, ".")
+	otherUser := encoding.EncodeToString([]byte(`{"sub":1,"typ":"access","iat":1579348800,"exp":1579349700}`))
+	tampered := parts[0] + "." + otherUser + "." + parts[2]
+
+	// signed properly, but with nothing to decode
+	unsigned := "not-json." + encoding.EncodeToString([]byte(`{}`))
+	undecodable := unsigned + "." + encoding.EncodeToString(signer.sign(unsigned))
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		now       time.Time
+		expected  error
+	}{
+		{"refresh token as access token", refresh, AccessToken, issuedAt, ErrWrongTokenType},
+		{"access token as refresh token", access, RefreshToken, issuedAt, ErrWrongTokenType},
+		{"expired", access, AccessToken, issuedAt.Add(15 * time.Minute), ErrExpiredToken},
+		{"another secret", forged, AccessToken, issuedAt, ErrInvalidSignature},
+		{"tampered claims", tampered, AccessToken, issuedAt, ErrInvalidSignature},
+		{"too few parts", parts[0] + "." + parts[1], AccessToken, issuedAt, ErrMalformedToken},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!", AccessToken, issuedAt, ErrMalformedToken},
+		{"empty", "", AccessToken, issuedAt, ErrMalformedToken},
+		{"segments not json", undecodable, AccessToken, issuedAt, ErrMalformedToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := signer.Verify(test.token, test.tokenType, test.now)
+			assert.Nil(t, claims)
+			assert.Equal(t, test.expected, err)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package rapid
+
+import (
+	"nba-pick-and-play/pkg/clock"
+	"strings"
+	"time"
+)
+
+type (
+	//CachedResponse a response for a date, as it was when it was fetched
+	CachedResponse struct {
+		Date      string
+		Response  NBAResponse
+		FetchedAt time.Time
+		Final     bool // every game had finished, so the response can't change
+	}
+
+	//ResponseCache persists the cached responses
+	ResponseCache interface {
+		LoadResponse(date string) (*CachedResponse, error) // nil when the date hasn't been cached, not an error
+		SaveResponse(response CachedResponse) error
+	}
+
+	//CachingClient a Client which only goes to the wrapped client for dates it doesn't have a fresh response for
+	//dates where every game has finished are kept for good, any others only for the ttl
+	CachingClient struct {
+		client Client
+		cache  ResponseCache
+		ttl    time.Duration
+		now    func() time.Time
+	}
+)
+
+//NewCachingClient wraps the client so responses are cached, a ttl of 0 only caches dates which have finished
+func NewCachingClient(client Client, cache ResponseCache, ttl time.Duration, clock clock.Clock) *CachingClient {
+	return &CachingClient{
+		client: client,
+		cache:  cache,
+		ttl:    ttl,
+		now:    clock.Now,
+	}
+}
+
+func (c *CachingClient) GetMatchesByDateRequest(date string) (*NBAResponse, error) {
+	cached, err := c.cache.LoadResponse(date)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+
+	if cached != nil && (cached.Final || now.Sub(cached.FetchedAt) < c.ttl) {
+		return &cached.Response, nil
+	}
+
+	response, err := c.client.GetMatchesByDateRequest(date)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.cache.SaveResponse(CachedResponse{
+		Date:      date,
+		Response:  *response,
+		FetchedAt: now,
+		Final:     isFinal(response),
+	})
+
+	return response, err
+}
+
+// a date with no games might just not have been scheduled yet, so it isn't final
+func isFinal(response *NBAResponse) bool {
+	games := response.ResponseWrapper.Games
+
+	for _, game := range games {
+		if !strings.EqualFold(game.StatusGame, "finished") {
+			return false
+		}
+	}
+
+	return len(games) > 0
+}
@@ -0,0 +1,81 @@
+package rapid
+
+import (
+	"nba-pick-and-play/pkg/clock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	memoryCache map[string]CachedResponse
+
+	// responds with a game in the given status
+	statusClient struct {
+		status string
+		calls  int
+	}
+)
+
+func (c memoryCache) LoadResponse(date string) (*CachedResponse, error) {
+	response, ok := c[date]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &response, nil
+}
+
+func (c memoryCache) SaveResponse(response CachedResponse) error {
+	c[response.Date] = response
+	return nil
+}
+
+func (c *statusClient) GetMatchesByDateRequest(date string) (*NBAResponse, error) {
+	c.calls++
+
+	return &NBAResponse{ResponseWrapper: ResponseWrapper{
+		Status: 200,
+		Games:  []NBAGame{{GameID: "7015", StatusGame: c.status}},
+	}}, nil
+}
+
+func TestCachingClient(t *testing.T) {
+	now := time.Date(2020, time.January, 18, 12, 0, 0, 0, time.UTC)
+
+	inner := &statusClient{status: "Scheduled"}
+	cache := memoryCache{}
+
+	client := NewCachingClient(inner, cache, 5*time.Minute, clock.NewMockClock(now))
+	client.now = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 2; i++ {
+		response, err := client.GetMatchesByDateRequest("2020-01-18")
+		assert.Nil(t, err)
+		assert.Equal(t, "Scheduled", response.ResponseWrapper.Games[0].StatusGame)
+	}
+
+	assert.Equal(t, 1, inner.calls)
+	assert.False(t, cache["2020-01-18"].Final)
+
+	// unfinished dates are fetched again once the ttl is up
+	inner.status = "Finished"
+	now = now.Add(5 * time.Minute)
+
+	response, err := client.GetMatchesByDateRequest("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, "Finished", response.ResponseWrapper.Games[0].StatusGame)
+	assert.Equal(t, 2, inner.calls)
+	assert.True(t, cache["2020-01-18"].Final)
+
+	// and finished ones never are
+	now = now.Add(365 * 24 * time.Hour)
+
+	_, err = client.GetMatchesByDateRequest("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, inner.calls)
+}
@@ -0,0 +1,149 @@
+package rapid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"nba-pick-and-play/pkg/clock"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type (
+	//FixtureMetadata written alongside every recorded response
+	FixtureMetadata struct {
+		Date       string    `json:"date"`
+		RecordedAt time.Time `json:"recordedAt"`
+		Games      int       `json:"games"`
+		Source     string    `json:"source"` // where the response came from, never the api key
+	}
+
+	//RecordingClient a Client which saves every response the wrapped client gets into a fixtures directory
+	RecordingClient struct {
+		client Client
+		dir    string
+		source string
+		now    func() time.Time
+	}
+
+	//ReplayClient a Client which only serves the responses recorded into a fixtures directory
+	ReplayClient struct {
+		dir string
+	}
+)
+
+//ErrNoFixture nothing was recorded for the date
+var ErrNoFixture = errors.New("rapid: no fixture recorded")
+
+// the response is saved as <date>.json, in the same format as the API so it can be used as a test file as it is,
+// with the metadata next to it in <date>.meta.json
+func fixturePaths(dir string, date string) (string, string) {
+	return filepath.Join(dir, date+".json"), filepath.Join(dir, date+".meta.json")
+}
+
+//NewRecordingClient wraps the client so its responses are recorded into dir, which is created if needed
+func NewRecordingClient(client Client, dir string, source string, clock clock.Clock) (*RecordingClient, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &RecordingClient{
+		client: client,
+		dir:    dir,
+		source: source,
+		now:    clock.Now,
+	}, nil
+}
+
+func (c *RecordingClient) GetMatchesByDateRequest(date string) (*NBAResponse, error) {
+	response, err := c.client.GetMatchesByDateRequest(date)
+
+	if err != nil {
+		return nil, err
+	}
+
+	responsePath, metadataPath := fixturePaths(c.dir, date)
+
+	if err := writeJSON(responsePath, response); err != nil {
+		return nil, fmt.Errorf("could not record %s: %w", date, err)
+	}
+
+	metadata := FixtureMetadata{
+		Date:       date,
+		RecordedAt: c.now(),
+		Games:      len(response.ResponseWrapper.Games),
+		Source:     c.source,
+	}
+
+	if err := writeJSON(metadataPath, metadata); err != nil {
+		return nil, fmt.Errorf("could not record %s: %w", date, err)
+	}
+
+	return response, nil
+}
+
+// writes to a temporary file first, so a failed write never leaves half a fixture behind
+func writeJSON(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+//NewReplayClient serves the responses recorded into dir
+func NewReplayClient(dir string) *ReplayClient {
+	return &ReplayClient{
+		dir: dir,
+	}
+}
+
+func (c *ReplayClient) GetMatchesByDateRequest(date string) (*NBAResponse, error) {
+	responsePath, _ := fixturePaths(c.dir, date)
+
+	b, err := ioutil.ReadFile(responsePath)
+
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w for %s in %s", ErrNoFixture, date, c.dir)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var response NBAResponse
+	if err := json.Unmarshal(b, &response); err != nil {
+		return nil, fmt.Errorf("%w: could not decode fixture for %s: %s", ErrBadResponse, date, err.Error())
+	}
+
+	return &response, nil
+}
+
+//Metadata what was recorded for the date
+func (c *ReplayClient) Metadata(date string) (*FixtureMetadata, error) {
+	_, metadataPath := fixturePaths(c.dir, date)
+
+	b, err := ioutil.ReadFile(metadataPath)
+
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w for %s in %s", ErrNoFixture, date, c.dir)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata FixtureMetadata
+	err = json.Unmarshal(b, &metadata)
+
+	return &metadata, err
+}
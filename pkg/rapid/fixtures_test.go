@@ -0,0 +1,41 @@
+package rapid
+
+import (
+	"errors"
+	"io/ioutil"
+	"nba-pick-and-play/pkg/clock"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	recordedAt := time.Date(2020, time.January, 18, 12, 0, 0, 0, time.UTC)
+
+	recorder, err := NewRecordingClient(&statusClient{status: "Finished"}, dir, "http://localhost/games/date/", clock.NewMockClock(recordedAt))
+	assert.Nil(t, err)
+
+	recorded, err := recorder.GetMatchesByDateRequest("2020-01-18")
+	assert.Nil(t, err)
+
+	replay := NewReplayClient(dir)
+
+	replayed, err := replay.GetMatchesByDateRequest("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, recorded, replayed)
+
+	metadata, err := replay.Metadata("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, metadata.Games)
+	assert.Equal(t, "http://localhost/games/date/", metadata.Source)
+	assert.True(t, recordedAt.Equal(metadata.RecordedAt))
+
+	_, err = replay.GetMatchesByDateRequest("2020-01-19")
+	assert.True(t, errors.Is(err, ErrNoFixture))
+}
@@ -0,0 +1,157 @@
+package rapid
+
+import (
+	"fmt"
+	"nba-pick-and-play/pkg/clock"
+	"sync"
+	"time"
+)
+
+type (
+	//Limits how many requests can be made, zero for no limit
+	Limits struct {
+		PerMinute int
+		PerDay    int // the API's quota resets at midnight UTC
+	}
+
+	//Usage the number of requests made on a day (UTC, "YYYY-MM-DD")
+	Usage struct {
+		Day      string
+		Requests int
+	}
+
+	//UsageStore persists the daily usage so the budget isn't reset by a restart
+	UsageStore interface {
+		LoadUsage(day string) (Usage, error) // no requests yet should be a zero Usage for the day, not an error
+		SaveUsage(usage Usage) error
+	}
+
+	//Quota how much of the budget is left
+	Quota struct {
+		Day            string `json:"day"`
+		Used           int    `json:"used"`
+		PerDay         int    `json:"perDay"`
+		Remaining      int    `json:"remaining"` // -1 when there's no daily limit
+		PerMinute      int    `json:"perMinute"`
+		UsedLastMinute int    `json:"usedLastMinute"`
+	}
+
+	//Limiter holds requests back to stay within the per minute limit, and refuses them once the day's budget is used up
+	Limiter struct {
+		limits Limits
+		usage  UsageStore
+		now    func() time.Time
+		sleep  func(time.Duration) // swapped out in tests so the per minute limit doesn't wait
+
+		mu     sync.Mutex
+		recent []time.Time // requests made in the last minute, oldest first
+	}
+)
+
+const usageDayFormat = "2006-01-02"
+
+var (
+	//ErrDailyBudgetExhausted every request in the day's budget has been made, also matches ErrQuotaExceeded
+	ErrDailyBudgetExhausted = fmt.Errorf("%w: daily budget used up", ErrQuotaExceeded)
+)
+
+//NewLimiter keeps requests within the limits, with the daily usage kept in the store
+func NewLimiter(limits Limits, usage UsageStore, clock clock.Clock) *Limiter {
+	return &Limiter{
+		limits: limits,
+		usage:  usage,
+		now:    clock.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+//Reserve waits for room in the per minute limit, then counts a request against the day's budget
+func (c *Limiter) Reserve() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for c.limits.PerMinute > 0 {
+		c.dropOlderThan(now.Add(-time.Minute))
+
+		if len(c.recent) < c.limits.PerMinute {
+			break
+		}
+
+		// let go of the lock while waiting, so the quota can still be read
+		wait := c.recent[0].Add(time.Minute).Sub(now)
+
+		c.mu.Unlock()
+		c.sleep(wait)
+		c.mu.Lock()
+
+		now = c.now()
+	}
+
+	day := now.UTC().Format(usageDayFormat)
+	usage, err := c.usage.LoadUsage(day)
+
+	if err != nil {
+		return err
+	}
+
+	usage.Day = day
+
+	if c.limits.PerDay > 0 && usage.Requests >= c.limits.PerDay {
+		return fmt.Errorf("%w: %d requests made on %s", ErrDailyBudgetExhausted, usage.Requests, usage.Day)
+	}
+
+	usage.Requests++
+
+	if err := c.usage.SaveUsage(usage); err != nil {
+		return err
+	}
+
+	c.recent = append(c.recent, now)
+	return nil
+}
+
+func (c *Limiter) dropOlderThan(cutoff time.Time) {
+	i := 0
+	for i < len(c.recent) && !c.recent[i].After(cutoff) {
+		i++
+	}
+
+	c.recent = c.recent[i:]
+}
+
+//Quota reports today's usage against the limits
+func (c *Limiter) Quota() (Quota, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.dropOlderThan(now.Add(-time.Minute))
+
+	day := now.UTC().Format(usageDayFormat)
+	usage, err := c.usage.LoadUsage(day)
+
+	if err != nil {
+		return Quota{}, err
+	}
+
+	quota := Quota{
+		Day:            day,
+		Used:           usage.Requests,
+		PerDay:         c.limits.PerDay,
+		Remaining:      -1,
+		PerMinute:      c.limits.PerMinute,
+		UsedLastMinute: len(c.recent),
+	}
+
+	if c.limits.PerDay > 0 {
+		quota.Remaining = c.limits.PerDay - usage.Requests
+
+		if quota.Remaining < 0 {
+			quota.Remaining = 0
+		}
+	}
+
+	return quota, nil
+}
@@ -0,0 +1,126 @@
+package rapid
+
+import (
+	"errors"
+	"fmt"
+	"nba-pick-and-play/pkg/clock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryUsage map[string]int // day -> requests
+
+func (u memoryUsage) LoadUsage(day string) (Usage, error) {
+	return Usage{Day: day, Requests: u[day]}, nil
+}
+
+func (u memoryUsage) SaveUsage(usage Usage) error {
+	u[usage.Day] = usage.Requests
+	return nil
+}
+
+// an API client given a limiter on a fake clock, which moves forward whenever the limiter waits
+func newLimitedTestClient(t *testing.T, limits Limits, usage memoryUsage) (*apiClient, *int, *[]time.Duration) {
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, gamesBody)
+	}))
+	t.Cleanup(server.Close)
+
+	now := time.Date(2020, time.January, 18, 23, 59, 30, 0, time.UTC)
+	var slept []time.Duration
+
+	limiter := NewLimiter(limits, usage, clock.NewMockClock(now))
+	limiter.now = func() time.Time {
+		return now
+	}
+	limiter.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+
+	client, _ := newTestClient(server.URL, Options{Limiter: limiter})
+	return client, &calls, &slept
+}
+
+func TestLimiterWaitsForThePerMinuteLimit(t *testing.T) {
+	client, calls, slept := newLimitedTestClient(t, Limits{PerMinute: 2}, memoryUsage{})
+
+	for i := 0; i < 3; i++ {
+		_, err := client.GetMatchesByDateRequest("2020-01-18")
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, 3, *calls)
+	assert.Equal(t, []time.Duration{time.Minute}, *slept)
+
+	quota, err := client.options.Limiter.Quota()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, quota.UsedLastMinute)
+	assert.Equal(t, -1, quota.Remaining)
+}
+
+func TestLimiterStopsAtTheDailyBudget(t *testing.T) {
+	usage := memoryUsage{"2020-01-18": 4} // made before a restart
+	client, calls, _ := newLimitedTestClient(t, Limits{PerDay: 5}, usage)
+
+	_, err := client.GetMatchesByDateRequest("2020-01-18")
+	assert.Nil(t, err)
+
+	_, err = client.GetMatchesByDateRequest("2020-01-18")
+	assert.True(t, errors.Is(err, ErrDailyBudgetExhausted))
+	assert.True(t, errors.Is(err, ErrQuotaExceeded))
+
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, 5, usage["2020-01-18"])
+
+	quota, err := client.options.Limiter.Quota()
+	assert.Nil(t, err)
+	assert.Equal(t, Quota{Day: "2020-01-18", Used: 5, PerDay: 5, Remaining: 0, UsedLastMinute: 1}, quota)
+
+	// the budget resets with the day
+	client.options.Limiter.sleep(time.Minute)
+
+	_, err = client.GetMatchesByDateRequest("2020-01-19")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, usage["2020-01-19"])
+}
+
+func TestLimiterLetsGoWhileWaiting(t *testing.T) {
+	limiter := NewLimiter(Limits{PerMinute: 1}, memoryUsage{}, clock.NewMockClock(time.Date(2020, time.January, 18, 12, 0, 0, 0, time.UTC)))
+
+	now := time.Date(2020, time.January, 18, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time {
+		return now
+	}
+
+	waiting := make(chan bool)
+	limiter.sleep = func(d time.Duration) {
+		waiting <- true
+		<-waiting
+		now = now.Add(d)
+	}
+
+	assert.Nil(t, limiter.Reserve())
+
+	done := make(chan error)
+	go func() {
+		done <- limiter.Reserve()
+	}()
+
+	<-waiting
+
+	// the quota can be read while the second request waits for the per minute limit
+	quota, err := limiter.Quota()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, quota.UsedLastMinute)
+
+	waiting <- true
+	assert.Nil(t, <-done)
+}
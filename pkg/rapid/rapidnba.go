@@ -2,8 +2,11 @@ package rapid
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"time"
 )
@@ -64,11 +67,101 @@ type (
 	apiClient struct {
 		baseURL string
 		apiKey  string
+		options Options
+		http    *http.Client
+		sleep   func(time.Duration) // swapped out in tests so retries don't wait
 	}
+
+	//Options how long to wait on the API and how hard to retry it, zero values fall back to the defaults
+	Options struct {
+		Timeout      time.Duration // per request
+		MaxRetries   int           // after the first attempt, negative to never retry
+		RetryBackoff time.Duration // doubled after every retry
+		MaxBackoff   time.Duration
+		Limiter      *Limiter // every attempt, retries included, is counted against it if set
+	}
+
+	//StatusError the API responded with a non 200 status code
+	StatusError struct {
+		StatusCode int
+		Body       string
+	}
+)
+
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+	defaultMaxBackoff   = 10 * time.Second
+)
+
+var (
+	//ErrQuotaExceeded the API key has run out of requests (429)
+	ErrQuotaExceeded = errors.New("rapid: quota exceeded")
+	//ErrUnauthorized the API key was rejected (401/403)
+	ErrUnauthorized = errors.New("rapid: unauthorized")
+	//ErrBadResponse the response couldn't be decoded, or wasn't a success
+	ErrBadResponse = errors.New("rapid: bad response")
 )
 
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("rapid: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// lets errors.Is match the status against the errors callers care about
+func (e *StatusError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests:
+		return ErrQuotaExceeded
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	default:
+		return nil
+	}
+}
+
+// server errors and dropped connections are worth another go, anything else would just fail again
+func isTransient(err error) bool {
+	var statusErr *StatusError
+
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
 func (c apiClient) GetMatchesByDateRequest(date string) (*NBAResponse, error) {
-	apiClient := http.Client{}
+	backoff := c.options.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		if c.options.Limiter != nil {
+			if err := c.options.Limiter.Reserve(); err != nil {
+				return nil, err
+			}
+		}
+
+		response, err := c.getMatchesByDate(date)
+
+		if err == nil {
+			return response, nil
+		}
+
+		if !isTransient(err) || attempt >= c.options.MaxRetries {
+			return nil, err
+		}
+
+		c.sleep(backoff)
+
+		backoff *= 2
+		if backoff > c.options.MaxBackoff {
+			backoff = c.options.MaxBackoff
+		}
+	}
+}
+
+func (c apiClient) getMatchesByDate(date string) (*NBAResponse, error) {
 	req, err := http.NewRequest("GET", c.baseURL+date, nil)
 
 	if err != nil {
@@ -77,7 +170,7 @@ func (c apiClient) GetMatchesByDateRequest(date string) (*NBAResponse, error) {
 
 	req.Header.Add("x-rapidapi-key", c.apiKey)
 
-	resp, err := apiClient.Do(req)
+	resp, err := c.http.Do(req)
 
 	if err != nil {
 		return nil, err
@@ -85,17 +178,50 @@ func (c apiClient) GetMatchesByDateRequest(date string) (*NBAResponse, error) {
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
 	var response NBAResponse
-	json.NewDecoder(resp.Body).Decode(&response)
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: could not decode games for %s: %s", ErrBadResponse, date, err.Error())
+	}
+
+	// the API also wraps its own status in the body
+	if response.ResponseWrapper.Status != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d for %s: %s", ErrBadResponse, response.ResponseWrapper.Status, date, response.ResponseWrapper.Message)
+	}
 
 	return &response, nil
 }
 
 //NewRapidAPIClient returns an implemented Client for use in the application
-func NewRapidAPIClient(url string, apiKey string) *apiClient {
+func NewRapidAPIClient(url string, apiKey string, options Options) *apiClient {
+	if options.Timeout == 0 {
+		options.Timeout = defaultTimeout
+	}
+
+	if options.MaxRetries == 0 {
+		options.MaxRetries = defaultMaxRetries
+	}
+
+	if options.RetryBackoff == 0 {
+		options.RetryBackoff = defaultRetryBackoff
+	}
+
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = defaultMaxBackoff
+	}
+
 	return &apiClient{
 		baseURL: url,
 		apiKey:  apiKey,
+		options: options,
+		http: &http.Client{
+			Timeout: options.Timeout,
+		},
+		sleep: time.Sleep,
 	}
 }
 
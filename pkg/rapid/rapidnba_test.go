@@ -0,0 +1,162 @@
+package rapid
+
+import (
+	"errors"
+	"fmt"
+	"nba-pick-and-play/pkg/clock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const gamesBody = `{"api":{"status":200,"message":"GET games/date/2020-01-18","results":1,"filters":[],"games":[{"gameId":"7015","statusGame":"Finished"}]}}`
+
+// a client for the test server which records its backoffs instead of sleeping
+func newTestClient(url string, options Options) (*apiClient, *[]time.Duration) {
+	var slept []time.Duration
+
+	client := NewRapidAPIClient(url+"/", "key", options)
+	client.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+	}
+
+	return client, &slept
+}
+
+// responds with each of the statuses in turn, then the games
+func newFlakyServer(t *testing.T, statuses ...int) (*httptest.Server, *int) {
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("x-rapidapi-key"))
+		assert.Equal(t, "/2020-01-18", r.URL.Path)
+
+		calls++
+
+		if calls <= len(statuses) {
+			w.WriteHeader(statuses[calls-1])
+			fmt.Fprintf(w, `{"message":"status %d"}`, statuses[calls-1])
+			return
+		}
+
+		fmt.Fprint(w, gamesBody)
+	}))
+
+	return server, &calls
+}
+
+func TestGetMatchesRetriesServerErrors(t *testing.T) {
+	server, calls := newFlakyServer(t, http.StatusBadGateway, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	client, slept := newTestClient(server.URL, Options{RetryBackoff: time.Second, MaxBackoff: 1500 * time.Millisecond})
+
+	response, err := client.GetMatchesByDateRequest("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, "7015", response.ResponseWrapper.Games[0].GameID)
+
+	assert.Equal(t, 3, *calls)
+	assert.Equal(t, []time.Duration{time.Second, 1500 * time.Millisecond}, *slept)
+}
+
+func TestGetMatchesGivesUpAfterMaxRetries(t *testing.T) {
+	server, calls := newFlakyServer(t, 500, 500, 500, 500)
+	defer server.Close()
+
+	client, _ := newTestClient(server.URL, Options{MaxRetries: 2})
+
+	_, err := client.GetMatchesByDateRequest("2020-01-18")
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, 500, statusErr.StatusCode)
+	assert.Equal(t, 3, *calls)
+}
+
+func TestGetMatchesCountsEveryAttempt(t *testing.T) {
+	server, calls := newFlakyServer(t, http.StatusBadGateway, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	usage := memoryUsage{}
+	limiter := NewLimiter(Limits{PerDay: 2}, usage, clock.NewMockClock(time.Date(2020, time.January, 18, 12, 0, 0, 0, time.UTC)))
+
+	client, _ := newTestClient(server.URL, Options{Limiter: limiter})
+
+	// the retry after the second failure would be a third request
+	_, err := client.GetMatchesByDateRequest("2020-01-18")
+	assert.True(t, errors.Is(err, ErrDailyBudgetExhausted))
+
+	assert.Equal(t, 2, *calls)
+	assert.Equal(t, 2, usage["2020-01-18"])
+}
+
+func TestGetMatchesTypedErrors(t *testing.T) {
+	tests := []struct {
+		status   int
+		expected error
+	}{
+		{http.StatusTooManyRequests, ErrQuotaExceeded},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			server, calls := newFlakyServer(t, test.status)
+			defer server.Close()
+
+			client, slept := newTestClient(server.URL, Options{})
+
+			_, err := client.GetMatchesByDateRequest("2020-01-18")
+			assert.True(t, errors.Is(err, test.expected))
+
+			// not worth retrying
+			assert.Equal(t, 1, *calls)
+			assert.Empty(t, *slept)
+		})
+	}
+}
+
+func TestGetMatchesBadResponses(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not json", `<html>oops</html>`},
+		{"wrapped error", `{"api":{"status":499,"message":"Something went wrong"}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, test.body)
+			}))
+			defer server.Close()
+
+			client, _ := newTestClient(server.URL, Options{})
+
+			_, err := client.GetMatchesByDateRequest("2020-01-18")
+			assert.True(t, errors.Is(err, ErrBadResponse))
+		})
+	}
+}
+
+func TestGetMatchesTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, gamesBody)
+	}))
+	defer server.Close()
+
+	client, slept := newTestClient(server.URL, Options{Timeout: 10 * time.Millisecond, MaxRetries: 1})
+
+	_, err := client.GetMatchesByDateRequest("2020-01-18")
+
+	var netErr interface{ Timeout() bool }
+	assert.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+	assert.Equal(t, 1, len(*slept))
+}
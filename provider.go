@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"nba-pick-and-play/config"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// where the games come from, so the ingest isn't tied to any one sports data API
+type gameProvider interface {
+	// the games starting on the (UTC) date
+	GamesByDate(date string) ([]game, error)
+}
+
+const (
+	providerRapid = "rapid"
+	providerFile  = "file"
+)
+
+var (
+	errInvalidScheduleFile = errors.New("invalid schedule file")
+
+	// the columns a csv schedule file can have, and the ones it has to
+	scheduleColumns         = []string{"id", "season", "stage", "gameDay", "start", "status", "homeId", "homeName", "homeNickname", "homeScore", "awayId", "awayName", "awayNickname", "awayScore", "period", "clock", "arena", "city", "country"}
+	requiredScheduleColumns = []string{"id", "season", "start", "status", "homeId", "homeName", "awayId", "awayName"}
+)
+
+// a schedule and results file kept by hand (or exported from elsewhere), as either json or csv
+type fileProvider struct {
+	path string
+}
+
+func setupProvider() error {
+	switch config.Config.Provider.Source {
+	case "", providerRapid:
+		provider = rapidProvider{}
+	case providerFile:
+		provider = fileProvider{path: config.Config.Provider.File}
+	default:
+		return fmt.Errorf("unknown game provider %s", config.Config.Provider.Source)
+	}
+
+	return nil
+}
+
+// the file is read again on every call, so edits to it are picked up on the next poll
+func (p fileProvider) GamesByDate(date string) ([]game, error) {
+	games, err := p.readGames()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var onDate []game
+	for _, g := range games {
+		if g.StartDate.UTC().Format(basicDateFormat) == date {
+			onDate = append(onDate, g)
+		}
+	}
+
+	return onDate, nil
+}
+
+func (p fileProvider) readGames() ([]game, error) {
+	f, err := os.Open(p.path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var games []game
+
+	switch strings.ToLower(filepath.Ext(p.path)) {
+	case ".json":
+		if err := json.NewDecoder(f).Decode(&games); err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidScheduleFile, err.Error())
+		}
+	case ".csv":
+		if games, err = readScheduleCSV(f); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s is not a .json or .csv file", errInvalidScheduleFile, p.path)
+	}
+
+	for i := range games {
+		completeGame(&games[i])
+	}
+
+	return games, nil
+}
+
+// one game a row, with a header row naming the columns (see scheduleColumns) in any order
+func readScheduleCSV(r io.Reader) ([]game, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidScheduleFile, err.Error())
+	}
+
+	known := make(map[string]bool)
+	for _, name := range scheduleColumns {
+		known[name] = true
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown column %s", errInvalidScheduleFile, name)
+		}
+
+		columns[name] = i
+	}
+
+	for _, name := range requiredScheduleColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing the %s column", errInvalidScheduleFile, name)
+		}
+	}
+
+	var games []game
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			return games, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidScheduleFile, err.Error())
+		}
+
+		g, err := scheduleRowToGame(func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+
+			return ""
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", errInvalidScheduleFile, line, err.Error())
+		}
+
+		games = append(games, *g)
+	}
+}
+
+func scheduleRowToGame(column func(name string) string) (*game, error) {
+	var err error
+	g := game{
+		SeasonID:    column("season"),
+		SeasonStage: column("stage"),
+		GameDayID:   column("gameDay"),
+		Status:      column("status"),
+		Clock:       column("clock"),
+		HomeTeam: team{
+			Name:     column("homeName"),
+			Nickname: column("homeNickname"),
+		},
+		AwayTeam: team{
+			Name:     column("awayName"),
+			Nickname: column("awayNickname"),
+		},
+		Venue: venue{
+			Name:    column("arena"),
+			City:    column("city"),
+			Country: column("country"),
+		},
+	}
+
+	numbers := map[string]*int64{
+		"id":        &g.ID,
+		"homeId":    &g.HomeTeam.ID,
+		"homeScore": &g.HomeTeam.Score,
+		"awayId":    &g.AwayTeam.ID,
+		"awayScore": &g.AwayTeam.Score,
+		"period":    &g.Period,
+	}
+
+	for name, field := range numbers {
+		if column(name) == "" {
+			continue
+		}
+
+		if *field, err = strconv.ParseInt(column(name), 10, 64); err != nil {
+			return nil, fmt.Errorf("%s must be a number", name)
+		}
+	}
+
+	if g.ID == 0 || g.HomeTeam.ID == 0 || g.AwayTeam.ID == 0 {
+		return nil, errors.New("id, homeId and awayId are needed")
+	}
+
+	if g.StartDate, err = time.Parse(time.RFC3339, column("start")); err != nil {
+		return nil, fmt.Errorf("start must be in the format %s", time.RFC3339)
+	}
+
+	return &g, nil
+}
+
+// fills in what can be worked out from the rest of the game, for providers which don't give it
+func completeGame(g *game) {
+	g.StartDate = g.StartDate.UTC()
+
+	if g.State == "" {
+		g.State = gameStateFromStatus(g.Status)
+	}
+
+	if g.GameDayID == "" {
+		g.GameDayID = gameDayIDFor(g.StartDate)
+	}
+
+	if g.State == stateFinished && g.WinnerID == 0 {
+		g.WinnerID = determineWinner(g.HomeTeam, g.AwayTeam)
+	}
+}
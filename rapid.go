@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	"nba-pick-and-play/pkg/rapid"
+	"strconv"
+	"strings"
+)
+
+type (
+	// keeps the Rapid API usage in the store, for the limited client
+	apiUsageStore struct{}
+
+	// keeps the Rapid API responses in the store, for the caching client
+	apiResponseCache struct{}
+
+	// games from the Rapid API, through rapidAPIClient
+	rapidProvider struct{}
+)
+
+const (
+	rapidModeLive   = "live"
+	rapidModeRecord = "record"
+	rapidModeReplay = "replay"
+)
+
+// the Rapid API client, cached in front of the limiter so that cached dates don't use up any of the quota
+// recording sits between the two, so only responses which actually came from the API are recorded
+func setupRapidClient() error {
+	rapidLimiter = nil
+
+	mode := config.Config.Rapid.Mode
+	if mode == "" {
+		mode = rapidModeLive
+	}
+
+	if mode == rapidModeReplay {
+		rapidAPIClient = rapid.NewReplayClient(config.Config.Rapid.FixturesDir)
+		return nil
+	}
+
+	if mode != rapidModeLive && mode != rapidModeRecord {
+		return fmt.Errorf("unknown rapid mode %s", mode)
+	}
+
+	limiter := rapid.NewLimiter(
+		rapid.Limits{
+			PerMinute: config.Config.Rapid.RequestsPerMinute,
+			PerDay:    config.Config.Rapid.RequestsPerDay,
+		},
+		apiUsageStore{},
+		clock,
+	)
+
+	// the limiter counts every attempt, as a retried call makes more than one request
+	var client rapid.Client = rapid.NewRapidAPIClient(config.Config.Rapid.BaseURL, config.Config.Rapid.APIKey, rapid.Options{
+		Timeout:      config.Config.Rapid.Timeout.Duration,
+		MaxRetries:   config.Config.Rapid.MaxRetries,
+		RetryBackoff: config.Config.Rapid.RetryBackoff.Duration,
+		Limiter:      limiter,
+	})
+
+	if mode == rapidModeRecord {
+		recorder, err := rapid.NewRecordingClient(client, config.Config.Rapid.FixturesDir, config.Config.Rapid.BaseURL, clock)
+
+		if err != nil {
+			return err
+		}
+
+		client = recorder
+	}
+
+	rapidLimiter = limiter
+	rapidAPIClient = rapid.NewCachingClient(client, apiResponseCache{}, config.Config.Rapid.CacheTTL.Duration, clock)
+	return nil
+}
+
+func (rapidProvider) GamesByDate(date string) ([]game, error) {
+	res, err := rapidAPIClient.GetMatchesByDateRequest(date)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var games []game
+	for _, rapidGame := range res.ResponseWrapper.Games {
+		game, err := rapidGameToGame(rapidGame) // convert to our mongo schema
+
+		if err != nil {
+			return nil, fmt.Errorf("could not convert rapid game to game %s: %s", rapidGame.GameID, err.Error())
+		}
+
+		games = append(games, *game)
+	}
+
+	return games, nil
+}
+
+func rapidGameToGame(rapidGame rapid.NBAGame) (*game, error) {
+	matchID, err := strconv.ParseInt(rapidGame.GameID, 10, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	state := gameStateFromStatus(rapidGame.StatusGame)
+
+	homeTeam, err := rapidTeamToTeam(rapidGame.HTeam, state)
+
+	if err != nil {
+		return nil, err
+	}
+
+	awayTeam, err := rapidTeamToTeam(rapidGame.VTeam, state)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: parse date irregularities
+	game := &game{
+		ID:          matchID,
+		SeasonID:    rapidGame.SeasonYear,
+		Status:      rapidGame.StatusGame,
+		State:       state,
+		SeasonStage: rapidGame.SeasonStage,
+		StartDate:   rapidGame.StartTimeUTC,
+		HomeTeam:    *homeTeam,
+		AwayTeam:    *awayTeam,
+		Venue: venue{
+			Name:    rapidGame.Arena,
+			City:    rapidGame.City,
+			Country: rapidGame.Country,
+		},
+	}
+
+	if state == stateFinished {
+		game.WinnerID = determineWinner(game.HomeTeam, game.AwayTeam)
+	}
+
+	// rapid gives every game a period, even those yet to start
+	if state == stateLive || state == stateFinished {
+		if game.Period, err = parsePeriod(rapidGame.CurrentPeriod); err != nil {
+			return nil, err
+		}
+
+		game.Clock = rapidGame.Clock
+	}
+
+	// work out the game date id
+	game.GameDayID = gameDayIDFor(rapidGame.StartTimeUTC)
+
+	return game, nil
+}
+
+// the score is only read once the game has started, the points are empty before then
+func rapidTeamToTeam(rapidTeam rapid.NBATeam, state string) (*team, error) {
+	id, err := strconv.ParseInt(rapidTeam.TeamID, 10, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	team := team{
+		ID:       id,
+		Name:     rapidTeam.FullName,
+		Nickname: rapidTeam.NickName,
+		Logo:     rapidTeam.Logo,
+	}
+
+	if (state == stateLive || state == stateFinished) && rapidTeam.Score.Points != "" {
+		points, err := strconv.ParseInt(rapidTeam.Score.Points, 10, 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		team.Score = points
+	}
+
+	return &team, nil
+}
+
+func (apiUsageStore) LoadUsage(day string) (rapid.Usage, error) {
+	usage, err := store.FindAPIUsage(day)
+
+	if errors.Is(err, errNotFound) {
+		return rapid.Usage{Day: day}, nil
+	}
+
+	if err != nil {
+		return rapid.Usage{}, err
+	}
+
+	return rapid.Usage{Day: usage.ID, Requests: usage.Requests}, nil
+}
+
+func (apiUsageStore) SaveUsage(usage rapid.Usage) error {
+	return store.UpsertAPIUsage(apiUsage{
+		ID:       usage.Day,
+		Requests: usage.Requests,
+	})
+}
+
+func (apiResponseCache) LoadResponse(date string) (*rapid.CachedResponse, error) {
+	cached, err := store.FindAPIResponse(date)
+
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := rapid.CachedResponse{
+		Date:      cached.ID,
+		FetchedAt: cached.FetchedAt,
+		Final:     cached.Final,
+	}
+
+	err = json.Unmarshal([]byte(cached.Data), &response.Response)
+	return &response, err
+}
+
+func (apiResponseCache) SaveResponse(response rapid.CachedResponse) error {
+	data, err := json.Marshal(response.Response)
+
+	if err != nil {
+		return err
+	}
+
+	return store.UpsertAPIResponse(apiResponse{
+		ID:        response.Date,
+		Data:      string(data),
+		FetchedAt: response.FetchedAt,
+		Final:     response.Final,
+	})
+}
+
+// rapid gives the period as e.g. "3/4", the period being played out of the number of regulation periods
+func parsePeriod(period string) (int64, error) {
+	if period == "" {
+		return 0, nil
+	}
+
+	current := strings.SplitN(period, "/", 2)[0]
+	parsed, err := strconv.ParseInt(current, 10, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid period %s", period)
+	}
+
+	return parsed, nil
+}
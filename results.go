@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"sort"
 )
 
 type result struct {
-	UserID int64
-	Score  int64
+	UserID   int64
+	Username string
+	Score    int64
 }
 
 // get all the pick reports for that day, create a daily leaderboard
@@ -14,18 +16,31 @@ func createGameDayResults(date string) error {
 	filter := make(filter)
 	filter["evaluated"] = true
 
-	pickReports, err := findPickReportsByGameDayID(date, filter)
+	pickReports, err := store.FindPickReportsByGameDayID(date, filter)
 
 	if err != nil {
 		log.Errorf("when creating game day results: %s", err.Error())
 		return err
 	}
 
+	var userIDs []int64
+	for _, rep := range pickReports {
+		userIDs = append(userIDs, rep.UserID)
+	}
+
+	usernames, err := usernamesByID(userIDs)
+
+	if err != nil {
+		log.Errorf("when finding users for game day results: %s", err.Error())
+		return err
+	}
+
 	var results []result
 	for _, rep := range pickReports {
 		results = append(results, result{
-			UserID: rep.UserID,
-			Score:  rep.Score,
+			UserID:   rep.UserID,
+			Username: usernames[rep.UserID],
+			Score:    rep.Score,
 		})
 	}
 
@@ -34,7 +49,7 @@ func createGameDayResults(date string) error {
 		return results[i].Score > results[j].Score
 	})
 
-	err = upsertGameDayResults(date, results)
+	err = store.UpsertGameDayResults(date, results)
 
 	if err != nil {
 		log.Errorf("when upserting game day results: %s", err.Error())
@@ -44,27 +59,54 @@ func createGameDayResults(date string) error {
 }
 
 // do a full update of the season's results
-func updateLeaderboard(season string) error {
-	userScores, err := aggregateUserScoresForSeason(season)
+// gameDay is the game day which has just been evaluated, moving LastGameDayEvaluated on to it, or empty to leave it be
+func updateLeaderboard(season string, gameDay string) error {
+	existing, err := store.FindLeaderboardByID(season)
+
+	if err != nil && !errors.Is(err, errNotFound) {
+		log.Errorf("when finding leaderboard: %s", err.Error())
+		return err
+	}
+
+	lastGameDay := existing.LastGameDayEvaluated
+	if gameDay > lastGameDay {
+		lastGameDay = gameDay
+	}
+
+	userScores, err := store.AggregateUserScoresForSeason(season)
 
 	if err != nil {
 		log.Errorf("when creating leaderboard: %s", err.Error())
 		return err
 	}
 
+	var userIDs []int64
+	for _, user := range userScores {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	usernames, err := usernamesByID(userIDs)
+
+	if err != nil {
+		log.Errorf("when finding users for leaderboard: %s", err.Error())
+		return err
+	}
+
 	var users []leaderboardUser
 	for _, user := range userScores {
 		users = append(users, leaderboardUser{
-			UserID: user.ID,
-			Score:  user.Score,
+			UserID:   user.ID,
+			Username: usernames[user.ID],
+			Score:    user.Score,
 		})
 	}
 
 	board := leaderboard{
-		ID:        season,
-		Standings: users,
+		ID:                   season,
+		Standings:            users,
+		LastGameDayEvaluated: lastGameDay,
 	}
 
-	err = upsertLeaderboard(board)
+	err = store.UpsertLeaderboard(board)
 	return err
 }
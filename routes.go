@@ -8,14 +8,44 @@ import (
 	"nba-pick-and-play/pkg/response"
 	"net/http"
 	"time"
-
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type (
 	picksPayload struct {
-		GameDayID string          `json:"gameDayId"`
-		Picks     map[int64]int64 `json:"picks"` // game id -> winner
+		GameDayID  string          `json:"gameDayId"`
+		Picks      map[int64]int64 `json:"picks"`                // game id -> winner
+		Confidence map[int64]int64 `json:"confidence,omitempty"` // game id -> confidence, for confidence scored game days
+	}
+
+	refreshPayload struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	credentialsPayload struct {
+		Username string `json:"username" validate:"required,alphanum,min=3,max=32"`
+		Password string `json:"password" validate:"required,min=8,max=72"`
+	}
+
+	survivorPickPayload struct {
+		GameDayID string `json:"gameDayId" validate:"required"`
+		TeamID    int64  `json:"teamId" validate:"required"`
+	}
+
+	bracketPicksPayload struct {
+		Predictions map[string]seriesPredictionPayload `json:"predictions" validate:"required,min=1"` // series id -> prediction
+	}
+
+	seriesPredictionPayload struct {
+		WinnerID int64 `json:"winnerId"`
+		Games    int   `json:"games"`
+	}
+
+	leaguePayload struct {
+		Name string `json:"name" validate:"required,min=3,max=64"`
+	}
+
+	joinLeaguePayload struct {
+		InviteCode string `json:"inviteCode" validate:"required"`
 	}
 )
 
@@ -28,10 +58,10 @@ func getGameDayReport(w http.ResponseWriter, r *http.Request) {
 		date = getCurrentGameDay(clock.Now())
 	}
 
-	gameDayReport, err := findGameDayReportByID(date)
+	gameDayReport, err := store.FindGameDayReportByID(date)
 
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
+		if errors.Is(err, errNotFound) {
 			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find game day for date %s", date))
 			return
 		}
@@ -41,6 +71,17 @@ func getGameDayReport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	games, err := store.FindMatchesByGameDateID(date)
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	markLiveGames(gameDayReport, games)
+	markOpenGames(gameDayReport, clock.Now())
+
 	response.ReturnSuccess(w, http.StatusOK, gameDayReport)
 }
 
@@ -51,10 +92,10 @@ func getGameDayResultsReport(w http.ResponseWriter, r *http.Request) {
 		date = getCurrentGameDay(clock.Now().Add(-24 * time.Hour))
 	}
 
-	resultsReport, err := findGameDayResultsReportByID(date)
+	resultsReport, err := store.FindGameDayResultsReportByID(date)
 
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
+		if errors.Is(err, errNotFound) {
 			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find game day for date %s", date))
 			return
 		}
@@ -64,6 +105,16 @@ func getGameDayResultsReport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	league, ok := leagueFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	if league != nil {
+		response.ReturnSuccess(w, http.StatusOK, leagueResults(*resultsReport, *league))
+		return
+	}
+
 	response.ReturnSuccess(w, http.StatusOK, resultsReport)
 }
 
@@ -74,10 +125,10 @@ func getLeaderboard(w http.ResponseWriter, r *http.Request) {
 		season = config.Config.Rapid.Season
 	}
 
-	leaderboard, err := findLeaderboardByID(season)
+	leaderboard, err := store.FindLeaderboardByID(season)
 
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
+		if errors.Is(err, errNotFound) {
 			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find leaderboard for season %s", season))
 			return
 		}
@@ -87,9 +138,226 @@ func getLeaderboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	league, ok := leagueFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	if league != nil {
+		response.ReturnSuccess(w, http.StatusOK, leagueLeaderboard(*leaderboard, *league))
+		return
+	}
+
 	response.ReturnSuccess(w, http.StatusOK, leaderboard)
 }
 
+// the provisional standings for the game day (today's by default) while its games are being played
+func getLiveLeaderboard(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+
+	if date == "" {
+		date = getCurrentGameDay(clock.Now())
+	}
+
+	board, err := findLiveLeaderboard(date)
+
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find game day for date %s", date))
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	league, ok := leagueFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	if league != nil {
+		response.ReturnSuccess(w, http.StatusOK, leagueLiveLeaderboard(*board, *league))
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, board)
+}
+
+func getSurvivorStandings(w http.ResponseWriter, r *http.Request) {
+	season := r.URL.Query().Get("season")
+
+	if season == "" { // defaults to the current season
+		season = config.Config.Rapid.Season
+	}
+
+	standings, err := findSurvivorStandings(season)
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, standings)
+}
+
+func makeSurvivorPick(w http.ResponseWriter, r *http.Request) {
+	var payload survivorPickPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	entry, err := saveSurvivorPick(userFromContext(r.Context()).ID, payload)
+
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find game day for date %s", payload.GameDayID))
+			return
+		}
+
+		response.ReturnError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusCreated, entry)
+}
+
+func getBracket(w http.ResponseWriter, r *http.Request) {
+	season := r.URL.Query().Get("season")
+
+	if season == "" { // defaults to the current season
+		season = config.Config.Rapid.Season
+	}
+
+	view, err := findBracketView(season, userFromContext(r.Context()).ID)
+
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find bracket for season %s", season))
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, view)
+}
+
+func makeBracketPicks(w http.ResponseWriter, r *http.Request) {
+	var payload bracketPicksPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	predictions := make(map[string]seriesPrediction)
+	for seriesID, p := range payload.Predictions {
+		predictions[seriesID] = seriesPrediction{
+			WinnerID: p.WinnerID,
+			Games:    p.Games,
+		}
+	}
+
+	season := config.Config.Rapid.Season
+	entry, err := saveBracketPredictions(season, userFromContext(r.Context()).ID, predictions)
+
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find bracket for season %s", season))
+			return
+		}
+
+		response.ReturnError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusCreated, entry)
+}
+
+func getLeagues(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	leagues, err := findUserLeagues(user.ID)
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, leagues)
+}
+
+func postLeague(w http.ResponseWriter, r *http.Request) {
+	var payload leaguePayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	league, err := createLeague(userFromContext(r.Context()), payload.Name)
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusCreated, league)
+}
+
+func postJoinLeague(w http.ResponseWriter, r *http.Request) {
+	var payload joinLeaguePayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	league, err := joinLeague(userFromContext(r.Context()), payload.InviteCode)
+
+	if err != nil {
+		if errors.Is(err, errInvalidInvite) {
+			response.ReturnError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, league)
+}
+
+// resolves the optional league query param, writing the error response if the caller can't see the league
+// returns a nil league when no league was asked for
+func leagueFromQuery(w http.ResponseWriter, r *http.Request) (*league, bool) {
+	leagueID := r.URL.Query().Get("league")
+
+	if leagueID == "" {
+		return nil, true
+	}
+
+	league, err := findLeagueForMember(leagueID, userFromContext(r.Context()).ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, errNotFound):
+			response.ReturnError(w, http.StatusNotFound, fmt.Sprintf("could not find league %s", leagueID))
+		case errors.Is(err, errNotLeagueMember):
+			response.ReturnError(w, http.StatusForbidden, err.Error())
+		default:
+			log.Error(err.Error())
+			response.ReturnError(w, http.StatusInternalServerError, genericError)
+		}
+
+		return nil, false
+	}
+
+	return league, true
+}
+
 func makePicks(w http.ResponseWriter, r *http.Request) {
 	var payload picksPayload
 	err := json.NewDecoder(r.Body).Decode(&payload)
@@ -99,7 +367,9 @@ func makePicks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	picks, err := verifyPicks(payload.GameDayID, payload.Picks)
+	user := userFromContext(r.Context())
+
+	picks, err := verifyPicks(user.ID, payload)
 
 	if err != nil {
 		response.ReturnError(w, http.StatusBadRequest, err.Error())
@@ -108,7 +378,7 @@ func makePicks(w http.ResponseWriter, r *http.Request) {
 
 	// verified and legit so save them
 	gameDayPicks := gameDayPicks{
-		UserID:    12345, // TODO: user logic
+		UserID:    user.ID,
 		GameDayID: payload.GameDayID,
 		SeasonID:  config.Config.Rapid.Season,
 		Picks:     picks,
@@ -116,7 +386,7 @@ func makePicks(w http.ResponseWriter, r *http.Request) {
 		Date:      clock.Now(),
 	}
 
-	err = upsertGameDayPicks(gameDayPicks)
+	err = store.UpsertGameDayPicks(gameDayPicks)
 
 	if err != nil {
 		log.Error(err.Error())
@@ -126,3 +396,88 @@ func makePicks(w http.ResponseWriter, r *http.Request) {
 
 	response.ReturnSuccess(w, http.StatusCreated, nil)
 }
+
+func register(w http.ResponseWriter, r *http.Request) {
+	var payload credentialsPayload
+	if !decodeAndValidate(w, r, &payload) {
+		return
+	}
+
+	user, err := signUpUser(payload.Username, payload.Password)
+
+	if err != nil {
+		if errors.Is(err, errUsernameTaken) {
+			response.ReturnError(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		if errors.Is(err, errReservedUsername) {
+			response.ReturnError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusCreated, user)
+}
+
+func login(w http.ResponseWriter, r *http.Request) {
+	var payload credentialsPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+
+	if err != nil {
+		response.ReturnError(w, http.StatusBadRequest, "could not decode json payload")
+		return
+	}
+
+	user, err := authenticateUser(payload.Username, payload.Password)
+
+	if err != nil {
+		if errors.Is(err, errInvalidCredentials) {
+			response.ReturnError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	tokens, err := issueTokens(user)
+
+	if err != nil {
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, tokens)
+}
+
+func refresh(w http.ResponseWriter, r *http.Request) {
+	var payload refreshPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+
+	if err != nil {
+		response.ReturnError(w, http.StatusBadRequest, "could not decode json payload")
+		return
+	}
+
+	tokens, err := refreshTokens(payload.RefreshToken)
+
+	if err != nil {
+		if isAuthError(err) {
+			response.ReturnError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		log.Error(err.Error())
+		response.ReturnError(w, http.StatusInternalServerError, genericError)
+		return
+	}
+
+	response.ReturnSuccess(w, http.StatusOK, tokens)
+}
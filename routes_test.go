@@ -1,14 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	"nba-pick-and-play/pkg/auth"
 	clockPkg "nba-pick-and-play/pkg/clock"
+	"nba-pick-and-play/pkg/rapid"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,6 +35,13 @@ type (
 		CreatedAt string         `json:"createdAt"`
 	}
 
+	tokensResponse struct {
+		Code      int       `json:"code"`
+		Tokens    tokenPair `json:"data,omitempty"`
+		Error     string    `json:"error,omitempty"`
+		CreatedAt string    `json:"createdAt"`
+	}
+
 	picksResponse struct {
 		Code      int         `json:"code"`
 		Data      interface{} `json:"data,omitempty"`
@@ -123,7 +138,7 @@ func TestGetGameDayResultsReportSuccess(t *testing.T) {
 		},
 	}
 
-	err := upsertGameDayResults("2020-01-18", scores)
+	err := store.UpsertGameDayResults("2020-01-18", scores)
 	assert.Nil(t, err)
 
 	// call the endpoint
@@ -170,7 +185,7 @@ func TestGetLeaderboard(t *testing.T) {
 		LastGameDayEvaluated: "2020-01-18",
 	}
 
-	err := upsertLeaderboard(lboard)
+	err := store.UpsertLeaderboard(lboard)
 	assert.Nil(t, err)
 
 	// call the endpoint
@@ -186,7 +201,7 @@ func TestGetLeaderboard(t *testing.T) {
 	assert.Equal(t, http.StatusOK, res.StatusCode)
 }
 
-func TestMakePicksPastDeadline(t *testing.T) {
+func TestMakePicksLockedGame(t *testing.T) {
 	defer cleanDatabase(t)
 
 	// poll matches, create a report for the day
@@ -196,7 +211,9 @@ func TestMakePicksPastDeadline(t *testing.T) {
 	_, err = createGameDayReport("2020-01-18")
 	assert.Nil(t, err)
 
-	// missed deadline by half an hour (8:30pm is tip-off for first game)
+	user := createUser(t, "keegan")
+
+	// missed the first game's deadline by half an hour (8:30pm is tip-off for first game)
 	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 18, 21, 0, 0, 0, time.UTC))
 
 	defer setDefaultMockClock()
@@ -215,6 +232,8 @@ func TestMakePicksPastDeadline(t *testing.T) {
 	req, err := http.NewRequest("POST", "/v1/user/picks", body)
 	assert.Nil(t, err)
 
+	req = requestAsUser(req, user)
+
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(makePicks)
 	handler.ServeHTTP(w, req)
@@ -227,7 +246,562 @@ func TestMakePicksPastDeadline(t *testing.T) {
 	err = json.NewDecoder(res.Body).Decode(&response)
 	assert.Nil(t, err)
 
-	assert.Equal(t, "missed deadline: 2020-01-18 20:30:00 +0000 UTC", response.Error)
+	assert.Equal(t, "game 7015 locked at 2020-01-18 20:30:00 +0000 UTC", response.Error)
+}
+
+func TestMakePicksPastDeadline(t *testing.T) {
+	defer cleanDatabase(t)
+
+	// poll matches, create a report for the day
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	user := createUser(t, "keegan")
+
+	// every game has tipped off (2am is tip-off for the last games)
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 19, 2, 30, 0, 0, time.UTC))
+
+	defer setDefaultMockClock()
+
+	status, response := postPicks(t, user, picksPayload{
+		GameDayID: "2020-01-18",
+		Picks: map[int64]int64{
+			7025: 40,
+		},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "missed deadline: 2020-01-19 02:00:00 +0000 UTC", response.Error)
+}
+
+func TestMakePicksKeepsLockedPicks(t *testing.T) {
+	defer cleanDatabase(t)
+
+	// poll matches, create a report for the day
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	user := createUser(t, "keegan")
+
+	status, _ := postPicks(t, user, picksPayload{
+		GameDayID: "2020-01-18",
+		Picks: map[int64]int64{
+			7015: 23,
+			7025: 40,
+		},
+	})
+
+	assert.Equal(t, http.StatusCreated, status)
+
+	// the first game has tipped off, but the West Coast game hasn't
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 18, 21, 0, 0, 0, time.UTC))
+
+	defer setDefaultMockClock()
+
+	// resending the locked pick unchanged is fine
+	status, _ = postPicks(t, user, picksPayload{
+		GameDayID: "2020-01-18",
+		Picks: map[int64]int64{
+			7015: 23,
+			7025: 30,
+		},
+	})
+
+	assert.Equal(t, http.StatusCreated, status)
+
+	// leaving it out doesn't remove it either
+	status, _ = postPicks(t, user, picksPayload{
+		GameDayID: "2020-01-18",
+		Picks: map[int64]int64{
+			7024: 25,
+			7025: 30,
+		},
+	})
+
+	assert.Equal(t, http.StatusCreated, status)
+
+	picks, err := store.FindPickReportsByGameDayID("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(picks))
+
+	assert.Equal(t, int64(23), picks[0].Picks[7015].SelectionID)
+	assert.Equal(t, int64(25), picks[0].Picks[7024].SelectionID)
+	assert.Equal(t, int64(30), picks[0].Picks[7025].SelectionID)
+
+	// the report shows which games can still be picked
+	req, err := http.NewRequest("GET", "/v1/user/games?date=2020-01-18", nil)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	handler := http.HandlerFunc(getGameDayReport)
+	handler.ServeHTTP(w, req)
+
+	var response matchesResponse
+	err = json.NewDecoder(w.Result().Body).Decode(&response)
+	assert.Nil(t, err)
+
+	assert.False(t, response.Report.Games[7015].Open)
+	assert.True(t, response.Report.Games[7016].Open)
+	assert.True(t, response.Report.Games[7025].Open)
+}
+
+func TestMakePicksConfidence(t *testing.T) {
+	defer cleanDatabase(t)
+
+	err := store.UpsertSeason(season{ID: "2019", Scoring: scoringConfidence})
+	assert.Nil(t, err)
+
+	// poll matches, create a report for the day
+	err = pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	user := createUser(t, "keegan")
+
+	picks := map[int64]int64{
+		7015: 23,
+		7016: 21,
+		7017: 2,
+	}
+
+	tests := []struct {
+		name          string
+		confidence    map[int64]int64
+		expectedError string
+	}{
+		{"missing", map[int64]int64{7015: 1, 7016: 2}, "missing confidence for game 7017"},
+		{"out of range", map[int64]int64{7015: 1, 7016: 2, 7017: 4}, "confidence for game 7017 must be between 1 and 3"},
+		{"unpicked game", map[int64]int64{7015: 1, 7016: 2, 7017: 3, 7018: 4}, "confidence given for game 7018 without a pick"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response := postPicks(t, user, picksPayload{
+				GameDayID:  "2020-01-18",
+				Picks:      picks,
+				Confidence: test.confidence,
+			})
+
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Equal(t, test.expectedError, response.Error)
+		})
+	}
+
+	// a repeated confidence means it's not a ranking
+	status, response := postPicks(t, user, picksPayload{
+		GameDayID:  "2020-01-18",
+		Picks:      picks,
+		Confidence: map[int64]int64{7015: 1, 7016: 1, 7017: 3},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, response.Error, "confidence 1 used for more than one game")
+
+	status, _ = postPicks(t, user, picksPayload{
+		GameDayID:  "2020-01-18",
+		Picks:      picks,
+		Confidence: map[int64]int64{7015: 3, 7016: 1, 7017: 2},
+	})
+
+	assert.Equal(t, http.StatusCreated, status)
+
+	stored, err := store.FindPickReportsByGameDayID("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), stored[0].Picks[7015].Confidence)
+	assert.Equal(t, int64(2), stored[0].Picks[7017].Confidence)
+}
+
+func TestMakePicksConfidenceOnStandardGameDay(t *testing.T) {
+	defer cleanDatabase(t)
+
+	// poll matches, create a report for the day
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	user := createUser(t, "keegan")
+
+	status, response := postPicks(t, user, picksPayload{
+		GameDayID:  "2020-01-18",
+		Picks:      map[int64]int64{7015: 23},
+		Confidence: map[int64]int64{7015: 1},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "confidence can only be given for confidence scored game days", response.Error)
+}
+
+func TestMakePicksSpread(t *testing.T) {
+	defer cleanDatabase(t)
+
+	config.Config.Odds.File = "test/odds.json"
+	defer func() { config.Config.Odds.File = "" }()
+
+	err := store.UpsertSeason(season{ID: "2019", Scoring: scoringStandard, PickType: pickTypeSpread})
+	assert.Nil(t, err)
+
+	// poll matches, create a report for the day
+	err = pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	user := createUser(t, "keegan")
+
+	// the odds file has no spread for 7018
+	status, response := postPicks(t, user, picksPayload{
+		GameDayID: "2020-01-18",
+		Picks:     map[int64]int64{7015: 23, 7018: 1},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "game 7018 has no spread yet", response.Error)
+
+	status, _ = postPicks(t, user, picksPayload{
+		GameDayID: "2020-01-18",
+		Picks:     map[int64]int64{7015: 23, 7016: 4},
+	})
+
+	assert.Equal(t, http.StatusCreated, status)
+}
+
+func TestLeagues(t *testing.T) {
+	defer cleanDatabase(t)
+
+	owner := createUser(t, "keegan")
+	friend := createUser(t, "colleague")
+	outsider := createUser(t, "stranger")
+
+	status, response := callEndpoint(t, owner, "POST", "/v1/user/leagues", leaguePayload{Name: "Office"})
+	assert.Equal(t, http.StatusCreated, status)
+
+	var created league
+	err := json.Unmarshal(response.Data, &created)
+	assert.Nil(t, err)
+	assert.Equal(t, "Office", created.Name)
+	assert.Equal(t, []int64{owner.ID}, created.Members)
+	assert.Len(t, created.InviteCode, inviteCodeLength)
+
+	status, response = callEndpoint(t, friend, "POST", "/v1/user/leagues/join", joinLeaguePayload{InviteCode: "NOPE"})
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, errInvalidInvite.Error(), response.Error)
+
+	// invite codes aren't case sensitive
+	status, _ = callEndpoint(t, friend, "POST", "/v1/user/leagues/join", joinLeaguePayload{InviteCode: strings.ToLower(created.InviteCode)})
+	assert.Equal(t, http.StatusOK, status)
+
+	status, response = callEndpoint(t, friend, "GET", "/v1/user/leagues", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var leagues []league
+	err = json.Unmarshal(response.Data, &leagues)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(leagues))
+	assert.ElementsMatch(t, []int64{owner.ID, friend.ID}, leagues[0].Members)
+
+	// one leaderboard for the season, which each league sees its own members of
+	err = store.UpsertLeaderboard(leaderboard{
+		ID: "2019",
+		Standings: []leaderboardUser{
+			{UserID: outsider.ID, Username: outsider.Username, Score: 9},
+			{UserID: friend.ID, Username: friend.Username, Score: 7},
+			{UserID: owner.ID, Username: owner.Username, Score: 4},
+		},
+	})
+	assert.Nil(t, err)
+
+	err = store.UpsertGameDayResults("2020-01-18", []result{
+		{UserID: owner.ID, Username: owner.Username, Score: 4},
+		{UserID: outsider.ID, Username: outsider.Username, Score: 2},
+	})
+	assert.Nil(t, err)
+
+	status, response = callEndpoint(t, owner, "GET", "/v1/user/leaderboards?season=2019&league="+created.ID, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var board leaderboard
+	err = json.Unmarshal(response.Data, &board)
+	assert.Nil(t, err)
+	assert.Equal(t, []leaderboardUser{
+		{UserID: friend.ID, Username: friend.Username, Score: 7},
+		{UserID: owner.ID, Username: owner.Username, Score: 4},
+	}, board.Standings)
+
+	status, response = callEndpoint(t, owner, "GET", "/v1/user/results?date=2020-01-18&league="+created.ID, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var results gameDayResults
+	err = json.Unmarshal(response.Data, &results)
+	assert.Nil(t, err)
+	assert.Equal(t, []result{{UserID: owner.ID, Username: owner.Username, Score: 4}}, results.UserScores)
+
+	// the whole company is still on the season's leaderboard
+	status, response = callEndpoint(t, outsider, "GET", "/v1/user/leaderboards?season=2019", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	err = json.Unmarshal(response.Data, &board)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(board.Standings))
+
+	status, response = callEndpoint(t, outsider, "GET", "/v1/user/leaderboards?season=2019&league="+created.ID, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, errNotLeagueMember.Error(), response.Error)
+
+	status, _ = callEndpoint(t, outsider, "GET", "/v1/user/leaderboards?season=2019&league=unknown", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestSurvivor(t *testing.T) {
+	defer cleanDatabase(t)
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	keegan := createUser(t, "keegan")
+	colleague := createUser(t, "colleague")
+
+	// the Bucks were already used earlier in the season
+	err = store.UpsertSurvivorEntry(survivorEntry{
+		ID:       survivorEntryID("2019", colleague.ID),
+		SeasonID: "2019",
+		UserID:   colleague.ID,
+		Picks: map[string]survivorPick{
+			"2020-01-17": {GameID: 7001, TeamID: 21, Status: pickCorrect},
+		},
+	})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name          string
+		caller        *user
+		payload       survivorPickPayload
+		expectedError string
+	}{
+		{"not playing", keegan, survivorPickPayload{GameDayID: "2020-01-18", TeamID: 99}, "team 99 is not playing on game day 2020-01-18"},
+		{"already used", colleague, survivorPickPayload{GameDayID: "2020-01-18", TeamID: 21}, "team 21 was already picked on 2020-01-17"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response := callEndpoint(t, test.caller, "POST", "/v1/user/survivor/picks", test.payload)
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Equal(t, test.expectedError, response.Error)
+		})
+	}
+
+	status, _ := callEndpoint(t, keegan, "POST", "/v1/user/survivor/picks", survivorPickPayload{GameDayID: "2020-01-17", TeamID: 23})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// both sides of Pelicans @ Clippers
+	status, _ = callEndpoint(t, keegan, "POST", "/v1/user/survivor/picks", survivorPickPayload{GameDayID: "2020-01-18", TeamID: 23})
+	assert.Equal(t, http.StatusCreated, status)
+
+	status, _ = callEndpoint(t, colleague, "POST", "/v1/user/survivor/picks", survivorPickPayload{GameDayID: "2020-01-18", TeamID: 16})
+	assert.Equal(t, http.StatusCreated, status)
+
+	rapidAPIClient = rapid.NewMockRapidClient(map[string]string{
+		"2020-01-18": "test/2020-01-18_nextday.json",
+		"2020-01-19": "test/2020-01-19_nextday.json",
+	})
+
+	defer setDefaultMockRapidAPIClient()
+
+	err = pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = evaluateGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	// the Pelicans won 133-130
+	status, response := callEndpoint(t, keegan, "GET", "/v1/user/survivor", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var standings survivorStandings
+	err = json.Unmarshal(response.Data, &standings)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []survivorStatus{{UserID: colleague.ID, Username: "colleague", Survived: 2}}, standings.Alive)
+	assert.Equal(t, []survivorStatus{{UserID: keegan.ID, Username: "keegan", EliminatedOn: "2020-01-18"}}, standings.Eliminated)
+
+	status, response = callEndpoint(t, keegan, "POST", "/v1/user/survivor/picks", survivorPickPayload{GameDayID: "2020-01-18", TeamID: 4})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, errEliminated.Error(), response.Error)
+}
+
+func TestBracket(t *testing.T) {
+	defer cleanDatabase(t)
+
+	admin := createUser(t, "admin")
+	keegan := createUser(t, "keegan")
+
+	deadline := time.Date(2020, time.January, 19, 0, 0, 0, 0, time.UTC)
+	payload := bracketPayload{
+		Deadline: deadline,
+		Series: []seriesPayload{
+			{ID: "west", Round: 1, BestOf: 3, Teams: [2]int64{23, 16}},
+			{ID: "east", Round: 1, BestOf: 3, Teams: [2]int64{21, 4}},
+			{ID: "final", Round: 2, BestOf: 3, Feeders: [2]string{"west", "east"}},
+		},
+	}
+
+	status, _ := callEndpoint(t, admin, "PUT", "/v1/admin/brackets/2019", bracketPayload{
+		Deadline: deadline,
+		Series:   []seriesPayload{{ID: "final", Round: 2, Feeders: [2]string{"west", "east"}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = callEndpoint(t, admin, "PUT", "/v1/admin/brackets/2019", payload)
+	assert.Equal(t, http.StatusOK, status)
+
+	tests := []struct {
+		name          string
+		predictions   map[string]seriesPredictionPayload
+		expectedError string
+	}{
+		{
+			"missing series",
+			map[string]seriesPredictionPayload{"west": {WinnerID: 23, Games: 2}},
+			"every one of the 3 series needs a prediction",
+		},
+		{
+			"winner knocked out earlier",
+			map[string]seriesPredictionPayload{"west": {WinnerID: 23, Games: 2}, "east": {WinnerID: 21, Games: 3}, "final": {WinnerID: 16, Games: 2}},
+			"team 16 can't win series final",
+		},
+		{
+			"too long",
+			map[string]seriesPredictionPayload{"west": {WinnerID: 23, Games: 4}, "east": {WinnerID: 21, Games: 3}, "final": {WinnerID: 23, Games: 2}},
+			"series west must last between 2 and 3 games",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response := callEndpoint(t, keegan, "POST", "/v1/user/bracket/picks", bracketPicksPayload{Predictions: test.predictions})
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Equal(t, test.expectedError, response.Error)
+		})
+	}
+
+	status, _ = callEndpoint(t, keegan, "POST", "/v1/user/bracket/picks", bracketPicksPayload{
+		Predictions: map[string]seriesPredictionPayload{
+			"west":  {WinnerID: 23, Games: 2},
+			"east":  {WinnerID: 21, Games: 3},
+			"final": {WinnerID: 21, Games: 3},
+		},
+	})
+	assert.Equal(t, http.StatusCreated, status)
+
+	// the Clippers sweep the Pelicans, the Bucks beat the Nets in three, and the final is about to start
+	playoffGames := []struct {
+		home, away, winner int64
+	}{
+		{23, 16, 23}, {16, 23, 23},
+		{21, 4, 21}, {4, 21, 4}, {21, 4, 21},
+		{23, 21, 0},
+	}
+
+	for i, g := range playoffGames {
+		status, state := statusFinished, "" // the finished games were saved before games had a state
+		if g.winner == 0 {
+			status, state = "Scheduled", stateScheduled
+		}
+
+		err := store.UpsertMatch(game{
+			ID:          int64(9000 + i),
+			SeasonID:    "2019",
+			SeasonStage: seasonStagePlayoffs,
+			Status:      status,
+			State:       state,
+			GameDayID:   "2020-04-20",
+			StartDate:   time.Date(2020, time.April, 20+i, 0, 0, 0, 0, time.UTC),
+			WinnerID:    g.winner,
+			HomeTeam:    team{ID: g.home},
+			AwayTeam:    team{ID: g.away},
+		})
+		assert.Nil(t, err)
+	}
+
+	// polling regular season games leaves the bracket alone
+	err := pollGames("2020-01-18")
+	assert.Nil(t, err)
+
+	status, response := callEndpoint(t, keegan, "GET", "/v1/user/bracket", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var view bracketView
+	err = json.Unmarshal(response.Data, &view)
+	assert.Nil(t, err)
+	assert.Equal(t, [2]int64{0, 0}, view.Bracket.Series[2].Teams)
+
+	// but the first game of the final finishing decides everything up to it
+	status, _ = callEndpoint(t, admin, "PUT", "/v1/admin/games/9005", gameOverridePayload{Status: statusFinished, HomeScore: 101, AwayScore: 99})
+	assert.Equal(t, http.StatusOK, status)
+
+	status, response = callEndpoint(t, keegan, "GET", "/v1/user/bracket", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	err = json.Unmarshal(response.Data, &view)
+	assert.Nil(t, err)
+
+	final := view.Bracket.Series[2]
+	assert.Equal(t, [2]int64{23, 21}, final.Teams)
+	assert.Equal(t, 1, final.Wins[23])
+	assert.Zero(t, final.WinnerID)
+
+	// both first round winners and how long they took, a point for each
+	assert.Equal(t, pickCorrect, view.Entry.Predictions["west"].Status)
+	assert.Equal(t, int64(2), view.Entry.Predictions["west"].Points)
+	assert.Equal(t, int64(2), view.Entry.Predictions["east"].Points)
+	assert.Equal(t, pickPending, view.Entry.Predictions["final"].Status)
+	assert.Equal(t, []bracketStanding{{UserID: keegan.ID, Username: "keegan", Score: 4}}, view.Standings)
+
+	// too late to change anything now
+	clock = clockPkg.NewMockClock(deadline)
+	defer setDefaultMockClock()
+
+	status, response = callEndpoint(t, keegan, "POST", "/v1/user/bracket/picks", bracketPicksPayload{
+		Predictions: map[string]seriesPredictionPayload{"west": {WinnerID: 23, Games: 2}},
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, response.Error, errBracketLocked.Error())
+}
+
+// posts the picks to the endpoint as the given user
+func postPicks(t *testing.T, user *user, payload picksPayload) (int, picksResponse) {
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(payload)
+
+	req, err := http.NewRequest("POST", "/v1/user/picks", body)
+	assert.Nil(t, err)
+
+	req = requestAsUser(req, user)
+
+	w := httptest.NewRecorder()
+	handler := http.HandlerFunc(makePicks)
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+
+	var response picksResponse
+	err = json.NewDecoder(res.Body).Decode(&response)
+	assert.Nil(t, err)
+
+	return res.StatusCode, response
 }
 
 func TestMakePicksWrongGame(t *testing.T) {
@@ -240,6 +814,8 @@ func TestMakePicksWrongGame(t *testing.T) {
 	_, err = createGameDayReport("2020-01-18")
 	assert.Nil(t, err)
 
+	user := createUser(t, "keegan")
+
 	payload := picksPayload{
 		GameDayID: "2020-01-18",
 		Picks: map[int64]int64{
@@ -254,6 +830,8 @@ func TestMakePicksWrongGame(t *testing.T) {
 	req, err := http.NewRequest("POST", "/v1/user/picks", body)
 	assert.Nil(t, err)
 
+	req = requestAsUser(req, user)
+
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(makePicks)
 	handler.ServeHTTP(w, req)
@@ -279,6 +857,8 @@ func TestMakePicksSuccess(t *testing.T) {
 	_, err = createGameDayReport("2020-01-18")
 	assert.Nil(t, err)
 
+	user := createUser(t, "keegan")
+
 	payload := picksPayload{
 		GameDayID: "2020-01-18",
 		Picks: map[int64]int64{
@@ -303,6 +883,8 @@ func TestMakePicksSuccess(t *testing.T) {
 	req, err := http.NewRequest("POST", "/v1/user/picks", body)
 	assert.Nil(t, err)
 
+	req = requestAsUser(req, user)
+
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(makePicks)
 	handler.ServeHTTP(w, req)
@@ -311,13 +893,14 @@ func TestMakePicksSuccess(t *testing.T) {
 
 	assert.Equal(t, http.StatusCreated, res.StatusCode)
 
-	picks, err := findPickReportsByGameDayID("2020-01-18")
+	picks, err := store.FindPickReportsByGameDayID("2020-01-18")
 	assert.Nil(t, err)
 
 	assert.NotNil(t, picks)
 	assert.Equal(t, 1, len(picks))
 
 	pickReport := picks[0]
+	assert.Equal(t, user.ID, pickReport.UserID)
 	assert.Equal(t, "2020-01-18", pickReport.GameDayID)
 	assert.Equal(t, 11, len(pickReport.Picks))
 	assert.False(t, pickReport.Evaluated)
@@ -328,3 +911,506 @@ func TestMakePicksSuccess(t *testing.T) {
 		assert.Equal(t, "PENDING", p.Status)
 	}
 }
+
+func TestRegisterSuccess(t *testing.T) {
+	defer cleanDatabase(t)
+
+	payload := credentialsPayload{
+		Username: "Keegan",
+		Password: "password123",
+	}
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(payload)
+
+	// call the endpoint
+	req, err := http.NewRequest("POST", "/v1/auth/register", body)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	handler := http.HandlerFunc(register)
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	user, err := store.FindUserByUsername("keegan")
+	assert.Nil(t, err)
+
+	assert.NotZero(t, user.ID)
+	assert.NotEqual(t, "password123", user.PasswordHash)
+}
+
+func TestRegisterUsernameTaken(t *testing.T) {
+	defer cleanDatabase(t)
+
+	createUser(t, "keegan")
+
+	payload := credentialsPayload{
+		Username: "keegan",
+		Password: "password123",
+	}
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(payload)
+
+	// call the endpoint
+	req, err := http.NewRequest("POST", "/v1/auth/register", body)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	handler := http.HandlerFunc(register)
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+}
+
+func TestRegisterAdminUsername(t *testing.T) {
+	defer cleanDatabase(t)
+
+	payload := credentialsPayload{
+		Username: "Admin",
+		Password: "password123",
+	}
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(payload)
+
+	// call the endpoint
+	req, err := http.NewRequest("POST", "/v1/auth/register", body)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	handler := http.HandlerFunc(register)
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	_, err = store.FindUserByUsername("admin")
+	assert.True(t, errors.Is(err, errNotFound))
+}
+
+func TestLoginSuccess(t *testing.T) {
+	defer cleanDatabase(t)
+
+	registered := createUser(t, "keegan")
+
+	payload := credentialsPayload{
+		Username: "keegan",
+		Password: "password123",
+	}
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(payload)
+
+	// call the endpoint
+	req, err := http.NewRequest("POST", "/v1/auth/login", body)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	handler := http.HandlerFunc(login)
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var response tokensResponse
+	err = json.NewDecoder(res.Body).Decode(&response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, registered.ID, response.Tokens.User.ID)
+	assert.NotEmpty(t, response.Tokens.AccessToken)
+	assert.NotEmpty(t, response.Tokens.RefreshToken)
+
+	// 15 minutes after noon on the 18th
+	assert.Equal(t, time.Date(2020, time.January, 18, 12, 15, 0, 0, time.UTC), response.Tokens.AccessTokenExpiresAt.UTC())
+
+	// the access token should get the user through the middleware
+	req, err = http.NewRequest("GET", "/v1/user/leaderboards", nil)
+	assert.Nil(t, err)
+
+	req.Header.Set("Authorization", "Bearer "+response.Tokens.AccessToken)
+
+	var caller *user
+	w = httptest.NewRecorder()
+	requireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller = userFromContext(r.Context())
+	})).ServeHTTP(w, req)
+
+	assert.NotNil(t, caller)
+	assert.Equal(t, registered.ID, caller.ID)
+}
+
+func TestRefreshTokens(t *testing.T) {
+	defer cleanDatabase(t)
+
+	user := createUser(t, "keegan")
+
+	tokens, err := issueTokens(user)
+	assert.Nil(t, err)
+
+	// a day later the access token has expired, but the refresh token hasn't
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 19, 12, 0, 0, 0, time.UTC))
+
+	defer setDefaultMockClock()
+
+	payload := refreshPayload{
+		RefreshToken: tokens.RefreshToken,
+	}
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(payload)
+
+	// call the endpoint
+	req, err := http.NewRequest("POST", "/v1/auth/refresh", body)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	handler := http.HandlerFunc(refresh)
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var response tokensResponse
+	err = json.NewDecoder(res.Body).Decode(&response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, time.Date(2020, time.January, 19, 12, 15, 0, 0, time.UTC), response.Tokens.AccessTokenExpiresAt.UTC())
+
+	// access tokens can't be used as refresh tokens
+	_, err = refreshTokens(tokens.AccessToken)
+	assert.True(t, errors.Is(err, auth.ErrWrongTokenType))
+}
+
+func TestAuthMiddlewareRejectsBadTokens(t *testing.T) {
+	defer cleanDatabase(t)
+
+	user := createUser(t, "keegan")
+
+	tokens, err := issueTokens(user)
+	assert.Nil(t, err)
+
+	forger := auth.NewSigner("not-the-secret")
+	forged, _, err := forger.Issue(user.ID, auth.AccessToken, clock.Now(), time.Hour)
+	assert.Nil(t, err)
+
+	router := mux.NewRouter()
+	initRouter(router)
+
+	tests := []struct {
+		name          string
+		authorization string
+		clock         clockPkg.Clock
+		expectedError string
+	}{
+		{"missing", "", clock, "missing bearer token"},
+		{"forged", "Bearer " + forged, clock, auth.ErrInvalidSignature.Error()},
+		{"malformed", "Bearer nonsense", clock, auth.ErrMalformedToken.Error()},
+		{"refresh token", "Bearer " + tokens.RefreshToken, clock, auth.ErrWrongTokenType.Error()},
+		{"expired", "Bearer " + tokens.AccessToken, clockPkg.NewMockClock(time.Date(2020, time.January, 18, 13, 0, 0, 0, time.UTC)), auth.ErrExpiredToken.Error()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock = test.clock
+			defer setDefaultMockClock()
+
+			req, err := http.NewRequest("POST", "/v1/user/picks", nil)
+			assert.Nil(t, err)
+
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			res := w.Result()
+
+			assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+			var response picksResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			assert.Nil(t, err)
+
+			assert.Equal(t, test.expectedError, response.Error)
+		})
+	}
+}
+
+func TestPollLiveScores(t *testing.T) {
+	defer cleanDatabase(t)
+
+	user := createUser(t, "user")
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	rapidAPIClient = rapid.NewMockRapidClient(map[string]string{
+		"2020-01-18": "test/2020-01-18_nextday.json",
+		"2020-01-19": "test/2020-01-19_live.json",
+	})
+	defer setDefaultMockRapidAPIClient()
+
+	// before the first game tips off there's nothing to poll
+	err = pollCurrentGameDay()
+	assert.Nil(t, err)
+
+	game, err := store.FindMatchByID(7015)
+	assert.Nil(t, err)
+	assert.Equal(t, stateScheduled, game.State)
+
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 19, 1, 15, 0, 0, time.UTC))
+	defer setDefaultMockClock()
+
+	err = pollCurrentGameDay()
+	assert.Nil(t, err)
+
+	game, err = store.FindMatchByID(7017)
+	assert.Nil(t, err)
+	assert.Equal(t, stateLive, game.State)
+	assert.Equal(t, int64(78), game.HomeTeam.Score)
+	assert.Equal(t, int64(70), game.AwayTeam.Score)
+	assert.Equal(t, int64(3), game.Period)
+	assert.Equal(t, "4:21", game.Clock)
+	assert.Zero(t, game.WinnerID)
+
+	game, err = store.FindMatchByID(7019)
+	assert.Nil(t, err)
+	assert.Equal(t, stateScheduled, game.State)
+	assert.Zero(t, game.HomeTeam.Score)
+	assert.Zero(t, game.Period)
+
+	// the report shows the games as they're being played
+	status, response := callEndpoint(t, user, "GET", "/v1/user/games?date=2020-01-18", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var report gameDayReport
+	err = json.Unmarshal(response.Data, &report)
+	assert.Nil(t, err)
+
+	assert.Equal(t, stateFinished, report.Games[7015].State)
+	assert.Equal(t, stateLive, report.Games[7017].State)
+	assert.Equal(t, int64(78), report.Games[7017].HomeTeam.Score)
+	assert.Equal(t, int64(3), report.Games[7017].Period)
+	assert.Equal(t, "4:21", report.Games[7017].Clock)
+	assert.Equal(t, int64(2), report.Games[7018].Period)
+	assert.False(t, report.Games[7017].Open)
+}
+
+func TestStreamGameDay(t *testing.T) {
+	defer cleanDatabase(t)
+
+	user := createUser(t, "user")
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	picks := createPicks()
+	picks[7018] = pick{SelectionID: 10, Status: pickPending}
+
+	err = store.UpsertGameDayPicks(gameDayPicks{
+		UserID:    user.ID,
+		SeasonID:  "2019",
+		GameDayID: "2020-01-18",
+		Picks:     picks,
+		Date:      clock.Now(),
+	})
+	assert.Nil(t, err)
+
+	router := mux.NewRouter()
+	initRouter(router)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	tokens, err := issueTokens(user)
+	assert.Nil(t, err)
+
+	// the token goes in the query, as it would from a browser's EventSource
+	res, err := http.Get(server.URL + "/v1/user/live?date=2020-01-18&token=" + tokens.AccessToken)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	events := bufio.NewScanner(res.Body)
+	nextEvent := func() (string, string) {
+		var eventType, data string
+
+		for events.Scan() {
+			line := events.Text()
+
+			if line == "" && eventType != "" {
+				return eventType, data
+			}
+
+			if strings.HasPrefix(line, "event: ") {
+				eventType = strings.TrimPrefix(line, "event: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+
+		t.Fatal("the stream ended")
+		return "", ""
+	}
+
+	eventType, data := nextEvent()
+	assert.Equal(t, liveEventSnapshot, eventType)
+
+	var snapshot liveSnapshot
+	err = json.Unmarshal([]byte(data), &snapshot)
+	assert.Nil(t, err)
+	assert.Equal(t, stateScheduled, snapshot.Report.Games[7017].State)
+	assert.Equal(t, pickPending, snapshot.Picks[7017].Status)
+
+	// the games tip off
+	rapidAPIClient = rapid.NewMockRapidClient(map[string]string{
+		"2020-01-18": "test/2020-01-18_nextday.json",
+		"2020-01-19": "test/2020-01-19_live.json",
+	})
+	defer setDefaultMockRapidAPIClient()
+
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 19, 1, 15, 0, 0, time.UTC))
+	defer setDefaultMockClock()
+
+	err = pollCurrentGameDay()
+	assert.Nil(t, err)
+
+	// as the watcher would on every instance, the poll having been made by whichever holds the lease
+	liveUpdates.checkForChanges()
+
+	received := make(map[string]liveEvent)
+	for i := 0; i < 8; i++ { // a status and a pick event for each of 7015, 7016, 7017 and 7018
+		eventType, data := nextEvent()
+
+		var event liveEvent
+		err = json.Unmarshal([]byte(data), &event)
+		assert.Nil(t, err)
+
+		received[fmt.Sprintf("%s %d", eventType, event.GameID)] = event
+	}
+
+	status := received["status 7017"]
+	assert.Equal(t, stateScheduled, status.From)
+	assert.Equal(t, stateLive, status.Game.State)
+	assert.Equal(t, int64(78), status.Game.HomeTeam.Score)
+	assert.Equal(t, "4:21", status.Game.Clock)
+
+	assert.Equal(t, stateFinished, received["status 7015"].Game.State)
+
+	assert.Equal(t, pickWinning, received["pick 7017"].Pick.Status)
+	assert.Equal(t, int64(1), received["pick 7017"].Pick.Points.Total)
+	assert.Equal(t, pickLosing, received["pick 7018"].Pick.Status)
+	assert.Nil(t, received["pick 7018"].Pick.Points)
+	assert.Contains(t, []string{pickCorrect, pickIncorrect}, received["pick 7015"].Pick.Status)
+}
+
+func TestStreamGameDayNeedsToken(t *testing.T) {
+	router := mux.NewRouter()
+	initRouter(router)
+
+	req, err := http.NewRequest("GET", "/v1/user/live?date=2020-01-18", nil)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// only the stream takes the token from the query
+	user := createUser(t, "user")
+	defer cleanDatabase(t)
+
+	tokens, err := issueTokens(user)
+	assert.Nil(t, err)
+
+	req, err = http.NewRequest("GET", "/v1/user/games?date=2020-01-18&token="+tokens.AccessToken, nil)
+	assert.Nil(t, err)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestGetLiveLeaderboard(t *testing.T) {
+	defer cleanDatabase(t)
+
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	err = store.UpsertGameDayPicks(gameDayPicks{UserID: alice.ID, SeasonID: "2019", GameDayID: "2020-01-18", Picks: createPicks(), Date: clock.Now()})
+	assert.Nil(t, err)
+
+	err = store.UpsertGameDayPicks(gameDayPicks{UserID: bob.ID, SeasonID: "2019", GameDayID: "2020-01-18", Picks: map[int64]pick{
+		7015: {SelectionID: 16, Status: pickPending},
+		7016: {SelectionID: 21, Status: pickPending},
+		7017: {SelectionID: 28, Status: pickPending},
+	}, Date: clock.Now()})
+	assert.Nil(t, err)
+
+	// the first two games have finished and the next two are being played
+	rapidAPIClient = rapid.NewMockRapidClient(map[string]string{
+		"2020-01-18": "test/2020-01-18_nextday.json",
+		"2020-01-19": "test/2020-01-19_live.json",
+	})
+	defer setDefaultMockRapidAPIClient()
+
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 19, 1, 15, 0, 0, time.UTC))
+	defer setDefaultMockClock()
+
+	err = pollCurrentGameDay()
+	assert.Nil(t, err)
+
+	status, response := callEndpoint(t, alice, "GET", "/v1/user/leaderboards/live", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var board liveLeaderboard
+	err = json.Unmarshal(response.Data, &board)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "2020-01-18", board.GameDayID)
+	assert.False(t, board.Evaluated)
+	assert.Equal(t, []liveStanding{
+		{UserID: bob.ID, Username: "bob", Correct: 2, Undecided: 1, Score: 2, MaxScore: 3},
+		{UserID: alice.ID, Username: "alice", Correct: 1, Undecided: 9, Score: 1, MaxScore: 10},
+	}, board.Standings)
+
+	// nothing is saved until the game day is evaluated
+	report, err := store.FindGameDayReportByID("2020-01-18")
+	assert.Nil(t, err)
+	assert.False(t, report.Evaluated)
+
+	_, err = store.FindGameDayResultsReportByID("2020-01-18")
+	assert.True(t, errors.Is(err, errNotFound))
+
+	picks, err := findUserPicks("2020-01-18", bob.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, pickPending, picks[7016].Status)
+
+	status, _ = callEndpoint(t, alice, "GET", "/v1/user/leaderboards/live?date=2020-01-25", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	"nba-pick-and-play/pkg/rapid"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+type seasonImportSummary struct {
+	From           string   `json:"from"`
+	To             string   `json:"to"`
+	DatesPolled    int      `json:"datesPolled"`
+	GamesSaved     int      `json:"gamesSaved"`
+	ReportsCreated []string `json:"reportsCreated"` // the upcoming game days
+	Complete       bool     `json:"complete"`
+	ResumeFrom     string   `json:"resumeFrom,omitempty"` // the first date not polled, if the quota ran out
+}
+
+const maxImportDays = 366
+
+var (
+	errInvalidImportRange = errors.New("invalid import range")
+	errImportRunning      = errors.New("a season import is already running")
+
+	importingSeason int32 // 1 while an import started by an admin is running, see startSeasonImport
+)
+
+/*
+	Polls every date of the season from one date to another, then creates the game day reports for every upcoming
+	game day so users can make their picks days in advance.
+
+	The day after the last date is polled too, as that's where the late games of the last game day are listed. If the
+	Rapid API's daily budget runs out part way through, what has been polled so far is kept and the summary says which
+	date to carry on from. Finished dates which were polled are served from the cache after that, so don't use up the quota again.
+	Progress is given after every date, if there's anything to give it to.
+*/
+func importSeason(from string, to string, progress func(string)) (*seasonImportSummary, error) {
+	dates, err := importDates(from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	summary := seasonImportSummary{
+		From:           from,
+		To:             to,
+		ReportsCreated: []string{},
+		Complete:       true,
+	}
+
+	gameDays := make(map[string]bool)
+	playoffGameFinished := false
+
+	for _, date := range dates {
+		games, err := provider.GamesByDate(date)
+
+		if errors.Is(err, rapid.ErrQuotaExceeded) {
+			log.Warnf("stopping the season import at %s: %s", date, err.Error())
+
+			summary.Complete = false
+			summary.ResumeFrom = date
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("could not import games for date %s: %w", date, err)
+		}
+
+		games, finished, err := mergeSavedGames(games)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := store.UpsertMatches(games); err != nil {
+			return nil, fmt.Errorf("could not save games for date %s: %s", date, err.Error())
+		}
+
+		for _, game := range games {
+			gameDays[game.GameDayID] = true
+		}
+
+		summary.DatesPolled++
+		summary.GamesSaved += len(games)
+		playoffGameFinished = playoffGameFinished || finished
+
+		if progress != nil {
+			progress(fmt.Sprintf("polled %d of %d dates, saved %d games", summary.DatesPolled, len(dates), summary.GamesSaved))
+		}
+	}
+
+	// the game day still being played counts as upcoming, whatever the date
+	today := getCurrentGameDay(clock.Now())
+
+	var upcoming []string
+	for gameDay := range gameDays {
+		if gameDay >= today && gameDay >= from && gameDay <= to {
+			upcoming = append(upcoming, gameDay)
+		}
+	}
+
+	sort.Strings(upcoming)
+
+	for _, gameDay := range upcoming {
+		created, err := createUpcomingGameDayReport(gameDay)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if created {
+			summary.ReportsCreated = append(summary.ReportsCreated, gameDay)
+		}
+	}
+
+	if playoffGameFinished {
+		if err := updateBracket(config.Config.Rapid.Season); err != nil {
+			return nil, err
+		}
+	}
+
+	return &summary, nil
+}
+
+// runs the import in the background for an admin, with its progress in the job history, one import at a time
+func startSeasonImport(from string, to string) (*jobRun, error) {
+	// checked up front, as errors from the import itself only make it into the job history
+	if _, err := importDates(from, to); err != nil {
+		return nil, err
+	}
+
+	if !atomic.CompareAndSwapInt32(&importingSeason, 0, 1) {
+		return nil, errImportRunning
+	}
+
+	run := startJob(jobImport, func(progress func(string)) error {
+		defer atomic.StoreInt32(&importingSeason, 0)
+
+		summary, err := importSeason(from, to, progress)
+
+		if err != nil {
+			return err
+		}
+
+		progress(summary.String())
+		return nil
+	})
+
+	return &run, nil
+}
+
+// e.g. for the job history
+func (s seasonImportSummary) String() string {
+	description := fmt.Sprintf("imported %d games from %d dates, created %d game day reports", s.GamesSaved, s.DatesPolled, len(s.ReportsCreated))
+
+	if !s.Complete {
+		description += fmt.Sprintf(", the Rapid API quota ran out so import again from %s", s.ResumeFrom)
+	}
+
+	return description
+}
+
+// for the -import-from and -import-to flags
+func runSeasonImport(from string, to string) {
+	summary, err := importSeason(from, to, nil)
+
+	if err != nil {
+		log.Fatalf("season import failed: %s", err.Error())
+	}
+
+	log.Printf("Imported %d games from %d dates, created %d game day reports", summary.GamesSaved, summary.DatesPolled, len(summary.ReportsCreated))
+
+	if !summary.Complete {
+		log.Warnf("the Rapid API quota ran out, run the import again from %s", summary.ResumeFrom)
+	}
+}
+
+// creates (or refreshes) the report for a game day which hasn't been evaluated yet
+func createUpcomingGameDayReport(gameDay string) (bool, error) {
+	existing, err := store.FindGameDayReportByID(gameDay)
+
+	if err != nil && !errors.Is(err, errNotFound) {
+		return false, err
+	}
+
+	if err == nil && existing.Evaluated {
+		return false, nil
+	}
+
+	if _, err := createGameDayReport(gameDay); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// every date from one to the other, and the day after
+func importDates(from string, to string) ([]string, error) {
+	if err := validateDates(from, to); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidImportRange, err.Error())
+	}
+
+	start, _ := time.Parse(basicDateFormat, from)
+	end, _ := time.Parse(basicDateFormat, to)
+
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: %s is before %s", errInvalidImportRange, to, from)
+	}
+
+	if end.Sub(start) > maxImportDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: can't import more than %d days at once", errInvalidImportRange, maxImportDays)
+	}
+
+	var dates []string
+	for date := start; !date.After(end.Add(24 * time.Hour)); date = date.Add(24 * time.Hour) {
+		dates = append(dates, date.Format(basicDateFormat))
+	}
+
+	return dates, nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	"os"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type (
+	scheduledJob struct {
+		Name    string       `json:"name"`
+		Spec    string       `json:"spec"`
+		Next    time.Time    `json:"next"`
+		entryID cron.EntryID // to find the next run
+	}
+
+	jobsSummary struct {
+		Timezone string         `json:"timezone"`
+		Instance string         `json:"instance"` // this instance, see instanceID
+		Lease    *lease         `json:"lease"`    // which instance runs the jobs, nil if none ever has
+		Jobs     []scheduledJob `json:"jobs"`
+		Runs     []jobRun       `json:"runs"` // most recent first
+	}
+)
+
+const (
+	jobResults = "results" // catches up on finished game days and creates the report for tonight, see dailyCron
+	jobRefresh = "refresh" // re-polls tonight's games and refreshes its report before tip-off
+	jobLive    = "live"    // polls tonight's games while they're being played
+
+	jobBackfill = "backfill" // the catch up on startup, not scheduled
+	jobImport   = "import"   // a season import an admin started, not scheduled
+
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+
+	jobRunTimeFormat    = "2006-01-02T15:04:05.000000000Z" // fixed width, so ids sort as text
+	defaultJobRunsLimit = 50
+	maxJobRunsLimit     = 500
+
+	schedulerLease  = "scheduler"
+	defaultLeaseTTL = 30 * time.Second
+)
+
+var (
+	jobTasks = map[string]func() error{
+		jobResults: dailyCron,
+		jobRefresh: refreshGameDay,
+		jobLive:    pollCurrentGameDay,
+	}
+
+	scheduler        *cron.Cron
+	scheduledJobs    []scheduledJob
+	scheduleLocation *time.Location // nil for times to be left in their own location
+	instanceID       string         // tells the instances sharing a database apart, see newInstanceID
+)
+
+// the schedule's timezone, which both the jobs and the current game day go by
+func setupScheduleLocation() error {
+	scheduleLocation = nil
+
+	if config.Config.Schedule.Timezone == "" {
+		return nil
+	}
+
+	location, err := time.LoadLocation(config.Config.Schedule.Timezone)
+
+	if err != nil {
+		return err
+	}
+
+	scheduleLocation = location
+	return nil
+}
+
+// registers every job in the config, a job still running when it's next due is skipped rather than run twice
+func setupScheduler() error {
+	location := time.Local
+	if scheduleLocation != nil {
+		location = scheduleLocation
+	}
+
+	scheduler = cron.New(
+		cron.WithLocation(location),
+		cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)),
+	)
+
+	scheduledJobs = nil
+
+	for _, job := range config.Config.Schedule.Jobs {
+		task, ok := jobTasks[job.Name]
+
+		if !ok {
+			return fmt.Errorf("unknown job %s", job.Name)
+		}
+
+		name := job.Name
+		entryID, err := scheduler.AddFunc(job.Spec, func() {
+			runScheduledJob(name, task)
+		})
+
+		if err != nil {
+			return fmt.Errorf("job %s: %w", job.Name, err)
+		}
+
+		scheduledJobs = append(scheduledJobs, scheduledJob{
+			Name:    job.Name,
+			Spec:    job.Spec,
+			entryID: entryID,
+		})
+	}
+
+	return nil
+}
+
+/*
+	Every instance sharing the database schedules the same jobs, so a job only runs on the instance holding the
+	scheduler lease. That way each run happens exactly once, however many instances there are.
+*/
+func runScheduledJob(name string, task func() error) {
+	held, err := acquireSchedulerLease()
+
+	if err != nil {
+		log.Errorf("skipping job %s, couldn't take the scheduler lease: %s", name, err.Error())
+		return
+	}
+
+	if !held {
+		log.Debugf("skipping job %s, another instance holds the scheduler lease", name)
+		return
+	}
+
+	runJob(name, task)
+}
+
+// runs the job, recording how it went in the job history
+func runJob(name string, task func() error) jobRun {
+	start := clock.Now()
+	err := task()
+
+	run := jobRun{
+		ID:        jobRunID(name, start),
+		Job:       name,
+		StartedAt: start,
+	}
+
+	finishJobRun(&run, err)
+	return run
+}
+
+/*
+	Runs the job in the background, returning its run straight away. The run is in the job history as running until
+	the job finishes, with whatever progress the job reports along the way.
+*/
+func startJob(name string, task func(progress func(string)) error) jobRun {
+	start := clock.Now()
+
+	run := jobRun{
+		ID:        jobRunID(name, start),
+		Job:       name,
+		StartedAt: start,
+		Status:    jobRunning,
+	}
+
+	saveJobRun(run)
+
+	go func(run jobRun) {
+		err := task(func(progress string) {
+			run.Progress = progress
+			run.Duration = clock.Now().Sub(run.StartedAt)
+			saveJobRun(run)
+		})
+
+		finishJobRun(&run, err)
+	}(run)
+
+	return run
+}
+
+func finishJobRun(run *jobRun, err error) {
+	run.Duration = clock.Now().Sub(run.StartedAt)
+	run.Status = jobSucceeded
+
+	if err != nil {
+		log.Errorf("job %s failed: %s", run.Job, err.Error())
+
+		run.Status = jobFailed
+		run.Error = err.Error()
+	}
+
+	saveJobRun(*run)
+}
+
+func saveJobRun(run jobRun) {
+	if err := store.UpsertJobRun(run); err != nil {
+		log.Errorf("when saving the run of job %s: %s", run.Job, err.Error())
+	}
+}
+
+// sorts by when the job ran
+func jobRunID(name string, start time.Time) string {
+	return fmt.Sprintf("%s:%s", start.UTC().Format(jobRunTimeFormat), name)
+}
+
+// the configured jobs with when they'll next run, and the most recent runs of any job
+func findJobsSummary(limit int) (*jobsSummary, error) {
+	runs, err := store.FindRecentJobRuns(limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lease, err := store.FindLease(schedulerLease)
+
+	if err != nil && !errors.Is(err, errNotFound) {
+		return nil, err
+	}
+
+	summary := jobsSummary{
+		Timezone: time.Local.String(),
+		Instance: instanceID,
+		Jobs:     []scheduledJob{},
+		Runs:     runs,
+	}
+
+	if err == nil {
+		summary.Lease = lease
+	}
+
+	if scheduleLocation != nil {
+		summary.Timezone = scheduleLocation.String()
+	}
+
+	if summary.Runs == nil {
+		summary.Runs = []jobRun{}
+	}
+
+	for _, job := range scheduledJobs {
+		if scheduler != nil {
+			job.Next = scheduler.Entry(job.entryID).Next
+		}
+
+		summary.Jobs = append(summary.Jobs, job)
+	}
+
+	return &summary, nil
+}
+
+// the host name and process id, with some random bytes in case those are the same across containers
+func newInstanceID() string {
+	host, err := os.Hostname()
+
+	if err != nil {
+		host = "unknown"
+	}
+
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		log.Warnf("couldn't generate a random instance id: %s", err.Error())
+	}
+
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(random))
+}
+
+func schedulerLeaseTTL() time.Duration {
+	ttl := config.Config.Schedule.LeaseTTL.Duration
+	if ttl <= 0 {
+		ttl = defaultLeaseTTL
+	}
+
+	return ttl
+}
+
+// takes the scheduler lease if it's free, or renews it if this instance already holds it
+func acquireSchedulerLease() (bool, error) {
+	now := clock.Now()
+
+	return store.AcquireLease(lease{
+		ID:        schedulerLease,
+		Holder:    instanceID,
+		RenewedAt: now,
+		ExpiresAt: now.Add(schedulerLeaseTTL()),
+	})
+}
+
+/*
+	Renews the scheduler lease well before it expires, so this instance keeps running the jobs for as long as it's up
+	and another instance only takes over once this one has stopped renewing it.
+*/
+func keepSchedulerLease() {
+	held := false
+	ticker := time.NewTicker(schedulerLeaseTTL() / 3)
+
+	for ; true; <-ticker.C {
+		acquired, err := acquireSchedulerLease()
+
+		if err != nil {
+			log.Errorf("couldn't renew the scheduler lease: %s", err.Error())
+			continue
+		}
+
+		if acquired != held {
+			if acquired {
+				log.Printf("Instance %s now holds the scheduler lease", instanceID)
+			} else {
+				log.Warnf("instance %s lost the scheduler lease", instanceID)
+			}
+		}
+
+		held = acquired
+	}
+}
+
+// the time in the schedule's timezone
+func inScheduleLocation(t time.Time) time.Time {
+	if scheduleLocation == nil {
+		return t
+	}
+
+	return t.In(scheduleLocation)
+}
+
+// polls the current game day's games again and refreshes its report, picking up any late schedule changes or odds
+func refreshGameDay() error {
+	gameDay := getCurrentGameDay(clock.Now())
+
+	if err := pollGameDayGames(gameDay); err != nil {
+		return err
+	}
+
+	_, err := createUpcomingGameDayReport(gameDay)
+	return err
+}
+
+/*
+	Polls tonight's games for their live scores while any of them are being played. Nothing is polled before the first
+	game tips off or once they're all over, so the job can be scheduled across the whole evening without using up the
+	quota. The games need to have been polled already, by the results or refresh job.
+*/
+func pollCurrentGameDay() error {
+	now := clock.Now()
+	gameDay := getCurrentGameDay(now)
+
+	games, err := store.FindMatchesByGameDateID(gameDay)
+
+	if err != nil {
+		return err
+	}
+
+	if !hasGamesInPlay(games, now) {
+		log.Debugf("no games being played for game day %s, not polling", gameDay)
+		return nil
+	}
+
+	return pollGameDayGames(gameDay)
+}
+
+// the game day's games are listed on its date and the day after
+func pollGameDayGames(gameDay string) error {
+	date, err := time.Parse(basicDateFormat, gameDay)
+
+	if err != nil {
+		return err
+	}
+
+	return pollGames(gameDay, date.Add(24*time.Hour).Format(basicDateFormat))
+}
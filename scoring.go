@@ -0,0 +1,146 @@
+package main
+
+type (
+	// works out what a correct pick is worth, so new ways of scoring can be added without touching the evaluation
+	scoringStrategy interface {
+		score(game gameReport, pick pick) points
+	}
+
+	// a point for every correct pick
+	standardScoring struct{}
+
+	// the confidence the user ranked the pick with
+	confidenceScoring struct{}
+
+	// adds a bonus on top of another strategy when the correct pick was the underdog
+	upsetBonusScoring struct {
+		base  scoringStrategy
+		bonus int64
+	}
+)
+
+// picks the strategy for the game day from the season settings copied onto its report
+func scoringStrategyFor(report gameDayReport) scoringStrategy {
+	var strategy scoringStrategy = standardScoring{}
+
+	if report.Scoring == scoringConfidence {
+		strategy = confidenceScoring{}
+	}
+
+	if report.UpsetBonus > 0 {
+		strategy = upsetBonusScoring{
+			base:  strategy,
+			bonus: report.UpsetBonus,
+		}
+	}
+
+	return strategy
+}
+
+func (standardScoring) score(game gameReport, pick pick) points {
+	return points{
+		Base:  1,
+		Total: 1,
+	}
+}
+
+func (confidenceScoring) score(game gameReport, pick pick) points {
+	return points{
+		Base:  pick.Confidence,
+		Total: pick.Confidence,
+	}
+}
+
+func (s upsetBonusScoring) score(game gameReport, pick pick) points {
+	p := s.base.score(game, pick)
+
+	if game.UnderdogID != 0 && pick.SelectionID == game.UnderdogID {
+		p.UpsetBonus = s.bonus
+		p.Total += s.bonus
+	}
+
+	return p
+}
+
+// the team expected to lose, going by the odds if they've been imported and the teams' records if not
+// returns 0 when neither team is favoured
+func findUnderdog(game gameReport) int64 {
+	if o := game.Odds; o != nil && o.HomeMoneyline != 0 && o.AwayMoneyline != 0 {
+		// the bigger the moneyline the less likely the team is to win
+		switch {
+		case o.HomeMoneyline > o.AwayMoneyline:
+			return game.HomeTeam.ID
+		case o.AwayMoneyline > o.HomeMoneyline:
+			return game.AwayTeam.ID
+		default:
+			return 0
+		}
+	}
+
+	if o := game.Odds; o != nil && o.Spread != nil {
+		// the team getting points is the underdog
+		switch {
+		case *o.Spread > 0:
+			return game.HomeTeam.ID
+		case *o.Spread < 0:
+			return game.AwayTeam.ID
+		default:
+			return 0
+		}
+	}
+
+	home, away := game.HomeRecord, game.AwayRecord
+
+	if home.played() == 0 || away.played() == 0 {
+		return 0
+	}
+
+	// compare the win percentages without dividing
+	homeWins, awayWins := home.Wins*away.played(), away.Wins*home.played()
+
+	switch {
+	case homeWins < awayWins:
+		return game.HomeTeam.ID
+	case awayWins < homeWins:
+		return game.AwayTeam.ID
+	default:
+		return 0
+	}
+}
+
+func (r teamRecord) played() int64 {
+	return r.Wins + r.Losses
+}
+
+// every team's win/loss record from the season's finished games before the game day
+func findTeamRecords(seasonID string, date string) (map[int64]teamRecord, error) {
+	games, err := store.FindMatchesBySeasonID(seasonID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fillMissingStates(games)
+
+	records := make(map[int64]teamRecord)
+	for _, game := range games {
+		// game day ids are YYYY-MM-DD, so they sort as dates
+		if game.GameDayID >= date || game.State != stateFinished || game.WinnerID == 0 {
+			continue
+		}
+
+		for _, t := range []team{game.HomeTeam, game.AwayTeam} {
+			record := records[t.ID]
+
+			if t.ID == game.WinnerID {
+				record.Wins++
+			} else {
+				record.Losses++
+			}
+
+			records[t.ID] = record
+		}
+	}
+
+	return records, nil
+}
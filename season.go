@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+)
+
+const (
+	scoringStandard   = "standard"   // a point for every correct pick
+	scoringConfidence = "confidence" // users rank their picks 1..N, and score the rank of every correct pick
+
+	pickTypeStraight = "straight" // pick the team which wins the game
+	pickTypeSpread   = "spread"   // pick the team which wins against the spread
+)
+
+// finds the settings for the season, falling back to the defaults if an admin hasn't configured it
+func findSeasonSettings(id string) (*season, error) {
+	settings, err := store.FindSeasonByID(id)
+
+	if errors.Is(err, errNotFound) {
+		return &season{
+			ID:       id,
+			Scoring:  scoringStandard,
+			PickType: pickTypeStraight,
+		}, nil
+	}
+
+	return settings, err
+}
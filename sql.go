@@ -0,0 +1,1039 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type (
+	// Store backed by a relational database, either sqlite (local runs and tests) or postgres
+	sqlStore struct {
+		db     *sql.DB
+		driver string
+	}
+
+	migration struct {
+		version    int
+		statements []string
+		fill       func(s *sqlStore, tx *sql.Tx) error // fills in new columns for the rows already saved, run after the statements
+	}
+)
+
+const (
+	driverSQLite   = "sqlite3"
+	driverPostgres = "postgres"
+
+	sqlDateFormat = "2006-01-02T15:04:05Z" // sorts correctly as text
+
+	upsertGameQuery = `INSERT INTO games (id, season_id, game_day_id, start_date, season_stage, data) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET season_id = excluded.season_id, game_day_id = excluded.game_day_id, start_date = excluded.start_date,
+		season_stage = excluded.season_stage, data = excluded.data`
+)
+
+/*
+	Documents are stored as bson extended json in a data column so the bson tags on our types stay the one definition
+	of the schema, with the fields we query or sort on pulled out into their own columns.
+
+	Only ever append to this list, a migration that has been run is never run again.
+*/
+var migrations = []migration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE games (
+				id BIGINT PRIMARY KEY,
+				season_id TEXT NOT NULL,
+				game_day_id TEXT NOT NULL,
+				start_date TEXT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX games_game_day_id ON games (game_day_id)`,
+			`CREATE TABLE game_days (
+				id TEXT PRIMARY KEY,
+				data TEXT NOT NULL
+			)`,
+			`CREATE TABLE picks (
+				id TEXT PRIMARY KEY,
+				user_id BIGINT NOT NULL,
+				season_id TEXT NOT NULL,
+				game_day_id TEXT NOT NULL,
+				evaluated BOOLEAN NOT NULL,
+				score BIGINT NOT NULL,
+				data TEXT NOT NULL,
+				UNIQUE (user_id, game_day_id, season_id)
+			)`,
+			`CREATE INDEX picks_season_id ON picks (season_id)`,
+			`CREATE TABLE game_day_results (
+				id TEXT PRIMARY KEY,
+				data TEXT NOT NULL
+			)`,
+			`CREATE TABLE leaderboards (
+				id TEXT PRIMARY KEY,
+				data TEXT NOT NULL
+			)`,
+			`CREATE TABLE users (
+				id {{serial}},
+				username TEXT NOT NULL UNIQUE,
+				data TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 2,
+		statements: []string{
+			`CREATE TABLE seasons (
+				id TEXT PRIMARY KEY,
+				data TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 3,
+		statements: []string{
+			`CREATE INDEX games_season_id ON games (season_id)`,
+		},
+	},
+	{
+		version: 4,
+		statements: []string{
+			`CREATE TABLE leagues (
+				id TEXT PRIMARY KEY,
+				invite_code TEXT NOT NULL UNIQUE,
+				data TEXT NOT NULL
+			)`,
+			`CREATE TABLE league_members (
+				league_id TEXT NOT NULL REFERENCES leagues (id),
+				user_id BIGINT NOT NULL,
+				PRIMARY KEY (league_id, user_id)
+			)`,
+			`CREATE INDEX league_members_user_id ON league_members (user_id)`,
+		},
+	},
+	{
+		version: 5,
+		statements: []string{
+			`CREATE TABLE survivor_entries (
+				id TEXT PRIMARY KEY,
+				season_id TEXT NOT NULL,
+				user_id BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX survivor_entries_season_id ON survivor_entries (season_id)`,
+		},
+	},
+	{
+		version: 6,
+		statements: []string{
+			`CREATE TABLE brackets (
+				id TEXT PRIMARY KEY,
+				data TEXT NOT NULL
+			)`,
+			`CREATE TABLE bracket_entries (
+				id TEXT PRIMARY KEY,
+				season_id TEXT NOT NULL,
+				user_id BIGINT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX bracket_entries_season_id ON bracket_entries (season_id)`,
+		},
+	},
+	{
+		version: 7,
+		statements: []string{
+			`CREATE TABLE api_usage (
+				id TEXT PRIMARY KEY,
+				data TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 8,
+		statements: []string{
+			`CREATE TABLE api_responses (
+				id TEXT PRIMARY KEY,
+				data TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 9,
+		statements: []string{
+			`CREATE TABLE job_runs (
+				id TEXT PRIMARY KEY,
+				job TEXT NOT NULL,
+				started_at TEXT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX job_runs_started_at ON job_runs (started_at)`,
+		},
+	},
+	{
+		version: 10,
+		statements: []string{
+			`CREATE TABLE leases (
+				id TEXT PRIMARY KEY,
+				holder TEXT NOT NULL,
+				expires_at TEXT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		// the bracket only needs a season's playoff games
+		version: 11,
+		statements: []string{
+			`ALTER TABLE games ADD COLUMN season_stage TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX games_season_id_season_stage ON games (season_id, season_stage)`,
+		},
+		fill: fillSeasonStages,
+	},
+}
+
+// filter field names (as used by mongo) -> the column holding them
+var gameFilterColumns = map[string]string{
+	"seasonStage": "season_stage",
+}
+
+var pickFilterColumns = map[string]string{
+	"userId":    "user_id",
+	"seasonId":  "season_id",
+	"gameDayId": "game_day_id",
+	"evaluated": "evaluated",
+}
+
+func newSQLStore(driver string, dsn string) (*sqlStore, error) {
+	if driver != driverSQLite && driver != driverPostgres {
+		return nil, fmt.Errorf("unsupported sql driver %s", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == driverSQLite {
+		// sqlite only allows a single writer, and each connection to ":memory:" would be its own database
+		db.SetMaxOpenConns(1)
+	}
+
+	store := &sqlStore{
+		db:     db,
+		driver: driver,
+	}
+
+	err = store.migrate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// runs every migration which hasn't already been applied, each in its own transaction
+func (s *sqlStore) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := s.db.Begin()
+
+		if err != nil {
+			return err
+		}
+
+		for _, statement := range m.statements {
+			if _, err := tx.Exec(s.ddl(statement)); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d failed: %s", m.version, err.Error())
+			}
+		}
+
+		if m.fill != nil {
+			if err := m.fill(s, tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d failed: %s", m.version, err.Error())
+			}
+		}
+
+		if _, err := tx.Exec(s.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), m.version); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) FindMatchByID(id int64) (*game, error) {
+	var game game
+	err := s.findDocument(&game, `SELECT data FROM games WHERE id = ?`, id)
+
+	return &game, err
+}
+
+func (s *sqlStore) FindMatchesByGameDateID(gameDateID string) ([]game, error) {
+	var games []game
+	err := s.findDocuments(func() interface{} {
+		games = append(games, game{})
+		return &games[len(games)-1]
+	}, `SELECT data FROM games WHERE game_day_id = ? ORDER BY start_date, id`, gameDateID)
+
+	return games, err
+}
+
+func (s *sqlStore) FindMatchesBySeasonID(seasonID string, filters ...filter) ([]game, error) {
+	where := []string{"season_id = ?"}
+	args := []interface{}{seasonID}
+
+	for _, f := range filters {
+		for k, v := range f {
+			column, ok := gameFilterColumns[k]
+
+			if !ok {
+				return nil, fmt.Errorf("cannot filter games by %s", k)
+			}
+
+			where = append(where, column+" = ?")
+			args = append(args, v)
+		}
+	}
+
+	var games []game
+	err := s.findDocuments(func() interface{} {
+		games = append(games, game{})
+		return &games[len(games)-1]
+	}, `SELECT data FROM games WHERE `+strings.Join(where, " AND ")+` ORDER BY start_date, id`, args...)
+
+	return games, err
+}
+
+func (s *sqlStore) UpsertMatch(game game) error {
+	data, err := encodeDocument(game)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(upsertGameQuery, game.ID, game.SeasonID, game.GameDayID, game.StartDate.UTC().Format(sqlDateFormat), game.SeasonStage, data)
+
+	return err
+}
+
+// all of the games or none of them
+func (s *sqlStore) UpsertMatches(games []game) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	for _, game := range games {
+		data, err := encodeDocument(game)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec(s.rebind(upsertGameQuery), game.ID, game.SeasonID, game.GameDayID, game.StartDate.UTC().Format(sqlDateFormat), game.SeasonStage, data)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) FindGameDayReportByID(id string) (*gameDayReport, error) {
+	var report gameDayReport
+	err := s.findDocument(&report, `SELECT data FROM game_days WHERE id = ?`, id)
+
+	return &report, err
+}
+
+func (s *sqlStore) UpsertGameDayReport(report gameDayReport) error {
+	return s.upsertDocument("game_days", report.ID, report)
+}
+
+func (s *sqlStore) FindPickReportsByGameDayID(date string, filters ...filter) ([]gameDayPicks, error) {
+	where := []string{"game_day_id = ?"}
+	args := []interface{}{date}
+
+	for _, f := range filters {
+		for k, v := range f {
+			column, ok := pickFilterColumns[k]
+
+			if !ok {
+				return nil, fmt.Errorf("cannot filter picks by %s", k)
+			}
+
+			where = append(where, column+" = ?")
+			args = append(args, v)
+		}
+	}
+
+	rows, err := s.query(`SELECT id, data FROM picks WHERE `+strings.Join(where, " AND ")+` ORDER BY user_id`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var picks []gameDayPicks
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+
+		var p gameDayPicks
+		if err := decodeDocument(data, &p); err != nil {
+			return nil, err
+		}
+
+		p.ID, err = primitive.ObjectIDFromHex(id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		picks = append(picks, p)
+	}
+
+	return picks, rows.Err()
+}
+
+func (s *sqlStore) UpsertGameDayPicks(picks gameDayPicks) error {
+	data, err := encodeDocument(picks)
+
+	if err != nil {
+		return err
+	}
+
+	// the id is only used on insert, an existing row keeps its own (as mongo's $set would)
+	_, err = s.exec(
+		`INSERT INTO picks (id, user_id, season_id, game_day_id, evaluated, score, data) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, game_day_id, season_id) DO UPDATE SET evaluated = excluded.evaluated, score = excluded.score, data = excluded.data`,
+		primitive.NewObjectID().Hex(), picks.UserID, picks.SeasonID, picks.GameDayID, picks.Evaluated, picks.Score, data,
+	)
+
+	return err
+}
+
+// the equivalent of the mongo aggregation pipeline, summing every user's scores for the season
+func (s *sqlStore) AggregateUserScoresForSeason(season string) ([]userScoreOutput, error) {
+	rows, err := s.query(
+		`SELECT user_id, SUM(score) AS total FROM picks WHERE season_id = ? GROUP BY user_id ORDER BY total DESC, user_id`,
+		season,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var out []userScoreOutput
+	for rows.Next() {
+		var score userScoreOutput
+		if err := rows.Scan(&score.ID, &score.Score); err != nil {
+			return nil, err
+		}
+
+		out = append(out, score)
+	}
+
+	return out, rows.Err()
+}
+
+func (s *sqlStore) FindGameDayResultsReportByID(id string) (*gameDayResults, error) {
+	var results gameDayResults
+	err := s.findDocument(&results, `SELECT data FROM game_day_results WHERE id = ?`, id)
+
+	return &results, err
+}
+
+func (s *sqlStore) UpsertGameDayResults(date string, results []result) error {
+	return s.upsertDocument("game_day_results", date, gameDayResults{
+		ID:         date,
+		UserScores: results,
+	})
+}
+
+func (s *sqlStore) FindLeaderboardByID(id string) (*leaderboard, error) {
+	var leaderboard leaderboard
+	err := s.findDocument(&leaderboard, `SELECT data FROM leaderboards WHERE id = ?`, id)
+
+	return &leaderboard, err
+}
+
+func (s *sqlStore) UpsertLeaderboard(leaderboard leaderboard) error {
+	return s.upsertDocument("leaderboards", leaderboard.ID, leaderboard)
+}
+
+func (s *sqlStore) FindSeasonByID(id string) (*season, error) {
+	var season season
+	err := s.findDocument(&season, `SELECT data FROM seasons WHERE id = ?`, id)
+
+	return &season, err
+}
+
+func (s *sqlStore) UpsertSeason(season season) error {
+	return s.upsertDocument("seasons", season.ID, season)
+}
+
+func (s *sqlStore) FindUserByID(id int64) (*user, error) {
+	return s.findUser(`SELECT id, data FROM users WHERE id = ?`, id)
+}
+
+func (s *sqlStore) FindUserByUsername(username string) (*user, error) {
+	return s.findUser(`SELECT id, data FROM users WHERE username = ?`, username)
+}
+
+func (s *sqlStore) FindUsersByIDs(ids []int64) ([]user, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	rows, err := s.query(`SELECT id, data FROM users WHERE id IN (`+strings.Join(placeholders, ", ")+`) ORDER BY id`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var users []user
+	for rows.Next() {
+		u, err := scanUser(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, *u)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *sqlStore) InsertUser(user user) (*user, error) {
+	data, err := encodeDocument(user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRow(
+		s.rebind(`INSERT INTO users (username, data) VALUES (?, ?) RETURNING id`),
+		user.Username, data,
+	).Scan(&user.ID)
+
+	if isUniqueViolation(err) {
+		return nil, errUsernameTaken
+	}
+
+	return &user, err
+}
+
+func (s *sqlStore) FindLeagueByID(id string) (*league, error) {
+	return s.findLeague(`SELECT data FROM leagues WHERE id = ?`, id)
+}
+
+func (s *sqlStore) FindLeagueByInviteCode(code string) (*league, error) {
+	return s.findLeague(`SELECT data FROM leagues WHERE invite_code = ?`, code)
+}
+
+func (s *sqlStore) findLeague(query string, args ...interface{}) (*league, error) {
+	var league league
+	if err := s.findDocument(&league, query, args...); err != nil {
+		return nil, err
+	}
+
+	members, err := s.findLeagueMembers(league.ID)
+	league.Members = members
+
+	return &league, err
+}
+
+func (s *sqlStore) FindLeaguesByMember(userID int64) ([]league, error) {
+	var leagues []league
+	err := s.findDocuments(func() interface{} {
+		leagues = append(leagues, league{})
+		return &leagues[len(leagues)-1]
+	}, `SELECT l.data FROM leagues l JOIN league_members m ON m.league_id = l.id WHERE m.user_id = ? ORDER BY l.id`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range leagues {
+		if leagues[i].Members, err = s.findLeagueMembers(leagues[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return leagues, nil
+}
+
+// members live in their own table so that joining doesn't need to rewrite the league
+func (s *sqlStore) findLeagueMembers(leagueID string) ([]int64, error) {
+	rows, err := s.query(`SELECT user_id FROM league_members WHERE league_id = ? ORDER BY user_id`, leagueID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var members []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+
+		members = append(members, userID)
+	}
+
+	return members, rows.Err()
+}
+
+func (s *sqlStore) InsertLeague(league league) error {
+	members := league.Members
+	league.Members = nil
+
+	data, err := encodeDocument(league)
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(s.rebind(`INSERT INTO leagues (id, invite_code, data) VALUES (?, ?, ?)`), league.ID, league.InviteCode, data)
+
+	if err != nil {
+		tx.Rollback()
+
+		if isUniqueViolation(err) {
+			return errLeagueExists
+		}
+
+		return err
+	}
+
+	for _, userID := range members {
+		if _, err := tx.Exec(s.rebind(`INSERT INTO league_members (league_id, user_id) VALUES (?, ?)`), league.ID, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) AddLeagueMember(leagueID string, userID int64) error {
+	var exists int
+	err := s.db.QueryRow(s.rebind(`SELECT 1 FROM leagues WHERE id = ?`), leagueID).Scan(&exists)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(
+		`INSERT INTO league_members (league_id, user_id) VALUES (?, ?) ON CONFLICT (league_id, user_id) DO NOTHING`,
+		leagueID, userID,
+	)
+
+	return err
+}
+
+func (s *sqlStore) FindSurvivorEntry(seasonID string, userID int64) (*survivorEntry, error) {
+	var entry survivorEntry
+	err := s.findDocument(&entry, `SELECT data FROM survivor_entries WHERE id = ?`, survivorEntryID(seasonID, userID))
+
+	return &entry, err
+}
+
+func (s *sqlStore) FindSurvivorEntriesBySeasonID(seasonID string) ([]survivorEntry, error) {
+	var entries []survivorEntry
+	err := s.findDocuments(func() interface{} {
+		entries = append(entries, survivorEntry{})
+		return &entries[len(entries)-1]
+	}, `SELECT data FROM survivor_entries WHERE season_id = ? ORDER BY user_id`, seasonID)
+
+	return entries, err
+}
+
+func (s *sqlStore) UpsertSurvivorEntry(entry survivorEntry) error {
+	data, err := encodeDocument(entry)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(
+		`INSERT INTO survivor_entries (id, season_id, user_id, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`,
+		entry.ID, entry.SeasonID, entry.UserID, data,
+	)
+
+	return err
+}
+
+func (s *sqlStore) FindBracketBySeasonID(seasonID string) (*bracket, error) {
+	var bracket bracket
+	err := s.findDocument(&bracket, `SELECT data FROM brackets WHERE id = ?`, seasonID)
+
+	return &bracket, err
+}
+
+func (s *sqlStore) UpsertBracket(bracket bracket) error {
+	return s.upsertDocument("brackets", bracket.ID, bracket)
+}
+
+func (s *sqlStore) FindBracketEntry(seasonID string, userID int64) (*bracketEntry, error) {
+	var entry bracketEntry
+	err := s.findDocument(&entry, `SELECT data FROM bracket_entries WHERE id = ?`, bracketEntryID(seasonID, userID))
+
+	return &entry, err
+}
+
+func (s *sqlStore) FindBracketEntriesBySeasonID(seasonID string) ([]bracketEntry, error) {
+	var entries []bracketEntry
+	err := s.findDocuments(func() interface{} {
+		entries = append(entries, bracketEntry{})
+		return &entries[len(entries)-1]
+	}, `SELECT data FROM bracket_entries WHERE season_id = ? ORDER BY user_id`, seasonID)
+
+	return entries, err
+}
+
+func (s *sqlStore) UpsertBracketEntry(entry bracketEntry) error {
+	data, err := encodeDocument(entry)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(
+		`INSERT INTO bracket_entries (id, season_id, user_id, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`,
+		entry.ID, entry.SeasonID, entry.UserID, data,
+	)
+
+	return err
+}
+
+func (s *sqlStore) FindAPIUsage(day string) (*apiUsage, error) {
+	var usage apiUsage
+	err := s.findDocument(&usage, `SELECT data FROM api_usage WHERE id = ?`, day)
+
+	return &usage, err
+}
+
+func (s *sqlStore) UpsertAPIUsage(usage apiUsage) error {
+	return s.upsertDocument("api_usage", usage.ID, usage)
+}
+
+func (s *sqlStore) FindAPIResponse(date string) (*apiResponse, error) {
+	var response apiResponse
+	err := s.findDocument(&response, `SELECT data FROM api_responses WHERE id = ?`, date)
+
+	return &response, err
+}
+
+func (s *sqlStore) UpsertAPIResponse(response apiResponse) error {
+	return s.upsertDocument("api_responses", response.ID, response)
+}
+
+func (s *sqlStore) UpsertJobRun(run jobRun) error {
+	data, err := encodeDocument(run)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(
+		`INSERT INTO job_runs (id, job, started_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`,
+		run.ID, run.Job, run.StartedAt.UTC().Format(sqlDateFormat), data,
+	)
+
+	return err
+}
+
+func (s *sqlStore) FindRecentJobRuns(limit int) ([]jobRun, error) {
+	var runs []jobRun
+	err := s.findDocuments(func() interface{} {
+		runs = append(runs, jobRun{})
+		return &runs[len(runs)-1]
+	}, `SELECT data FROM job_runs ORDER BY started_at DESC, id DESC LIMIT ?`, limit)
+
+	return runs, err
+}
+
+// the conflicting row is only updated when the lease is free to take, otherwise no rows are affected
+func (s *sqlStore) AcquireLease(lease lease) (bool, error) {
+	data, err := encodeDocument(lease)
+
+	if err != nil {
+		return false, err
+	}
+
+	result, err := s.exec(
+		`INSERT INTO leases (id, holder, expires_at, data) VALUES (?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at, data = excluded.data
+			WHERE leases.expires_at <= ? OR leases.holder = ?`,
+		lease.ID, lease.Holder, lease.ExpiresAt.UTC().Format(sqlDateFormat), data,
+		lease.RenewedAt.UTC().Format(sqlDateFormat), lease.Holder,
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+
+	return affected > 0, err
+}
+
+func (s *sqlStore) FindLease(id string) (*lease, error) {
+	var lease lease
+	err := s.findDocument(&lease, `SELECT data FROM leases WHERE id = ?`, id)
+
+	return &lease, err
+}
+
+func (s *sqlStore) findUser(query string, args ...interface{}) (*user, error) {
+	user, err := scanUser(s.db.QueryRow(s.rebind(query), args...))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+
+	return user, err
+}
+
+// the id column is the source of truth, as it's assigned after the data was encoded
+func scanUser(row interface{ Scan(...interface{}) error }) (*user, error) {
+	var id int64
+	var data string
+
+	if err := row.Scan(&id, &data); err != nil {
+		return nil, err
+	}
+
+	var u user
+	if err := decodeDocument(data, &u); err != nil {
+		return nil, err
+	}
+
+	u.ID = id
+	return &u, nil
+}
+
+// upserts a document into a table which only has id and data columns
+func (s *sqlStore) upsertDocument(table string, id string, doc interface{}) error {
+	data, err := encodeDocument(doc)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(
+		`INSERT INTO `+table+` (id, data) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data`,
+		id, data,
+	)
+
+	return err
+}
+
+func (s *sqlStore) findDocument(out interface{}, query string, args ...interface{}) error {
+	var data string
+	err := s.db.QueryRow(s.rebind(query), args...).Scan(&data)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return decodeDocument(data, out)
+}
+
+// decodes each row's data column into the value returned by next
+func (s *sqlStore) findDocuments(next func() interface{}, query string, args ...interface{}) error {
+	rows, err := s.query(query, args...)
+
+	if err != nil {
+		return err
+	}
+
+	return decodeRows(rows, next)
+}
+
+// findDocuments within a transaction
+func queryDocuments(tx *sql.Tx, next func() interface{}, query string) error {
+	rows, err := tx.Query(query)
+
+	if err != nil {
+		return err
+	}
+
+	return decodeRows(rows, next)
+}
+
+func decodeRows(rows *sql.Rows, next func() interface{}) error {
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+
+		if err := decodeDocument(data, next()); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// fills in the season stage of the games already saved, from their data
+func fillSeasonStages(s *sqlStore, tx *sql.Tx) error {
+	var games []game
+
+	// everything is read before anything is written, as postgres can't run a statement while rows are still being read
+	err := queryDocuments(tx, func() interface{} {
+		games = append(games, game{})
+		return &games[len(games)-1]
+	}, `SELECT data FROM games`)
+
+	if err != nil {
+		return err
+	}
+
+	for _, g := range games {
+		if _, err := tx.Exec(s.rebind(`UPDATE games SET season_stage = ? WHERE id = ?`), g.SeasonStage, g.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.db.Exec(s.rebind(query), args...)
+}
+
+func (s *sqlStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.Query(s.rebind(query), args...)
+}
+
+// queries are written with ? placeholders, which postgres wants as $1, $2...
+func (s *sqlStore) rebind(query string) string {
+	if s.driver != driverPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// swaps in the column types which differ between the databases
+func (s *sqlStore) ddl(statement string) string {
+	serial := "INTEGER PRIMARY KEY AUTOINCREMENT"
+
+	if s.driver == driverPostgres {
+		serial = "BIGSERIAL PRIMARY KEY"
+	}
+
+	return strings.Replace(statement, "{{serial}}", serial, -1)
+}
+
+func encodeDocument(doc interface{}) (string, error) {
+	b, err := bson.MarshalExtJSON(doc, true, false)
+	return string(b), err
+}
+
+func decodeDocument(data string, out interface{}) error {
+	return bson.UnmarshalExtJSON([]byte(data), true, out)
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505" // unique_violation
+	}
+
+	return false
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Store all of the data access used by the service, so the database behind it can be swapped out (or faked in tests)
+type Store interface {
+	FindMatchByID(id int64) (*game, error)
+	FindMatchesByGameDateID(gameDateID string) ([]game, error)
+	FindMatchesBySeasonID(seasonID string, filters ...filter) ([]game, error)
+	UpsertMatch(game game) error
+	UpsertMatches(games []game) error
+
+	FindGameDayReportByID(id string) (*gameDayReport, error)
+	UpsertGameDayReport(report gameDayReport) error
+
+	FindPickReportsByGameDayID(date string, filters ...filter) ([]gameDayPicks, error)
+	UpsertGameDayPicks(picks gameDayPicks) error
+	AggregateUserScoresForSeason(season string) ([]userScoreOutput, error)
+
+	FindGameDayResultsReportByID(id string) (*gameDayResults, error)
+	UpsertGameDayResults(date string, results []result) error
+
+	FindLeaderboardByID(id string) (*leaderboard, error)
+	UpsertLeaderboard(leaderboard leaderboard) error
+
+	FindSeasonByID(id string) (*season, error)
+	UpsertSeason(season season) error
+
+	FindUserByID(id int64) (*user, error)
+	FindUserByUsername(username string) (*user, error)
+	FindUsersByIDs(ids []int64) ([]user, error)
+	InsertUser(user user) (*user, error)
+
+	FindLeagueByID(id string) (*league, error)
+	FindLeagueByInviteCode(code string) (*league, error)
+	FindLeaguesByMember(userID int64) ([]league, error)
+	InsertLeague(league league) error
+	AddLeagueMember(leagueID string, userID int64) error
+
+	FindSurvivorEntry(seasonID string, userID int64) (*survivorEntry, error)
+	FindSurvivorEntriesBySeasonID(seasonID string) ([]survivorEntry, error)
+	UpsertSurvivorEntry(entry survivorEntry) error
+
+	FindBracketBySeasonID(seasonID string) (*bracket, error)
+	UpsertBracket(bracket bracket) error
+	FindBracketEntry(seasonID string, userID int64) (*bracketEntry, error)
+	FindBracketEntriesBySeasonID(seasonID string) ([]bracketEntry, error)
+	UpsertBracketEntry(entry bracketEntry) error
+
+	FindAPIUsage(day string) (*apiUsage, error)
+	UpsertAPIUsage(usage apiUsage) error
+	FindAPIResponse(date string) (*apiResponse, error)
+	UpsertAPIResponse(response apiResponse) error
+
+	UpsertJobRun(run jobRun) error
+	FindRecentJobRuns(limit int) ([]jobRun, error)
+
+	// takes the lease if it's free, has expired or is already held by the same holder, returning false otherwise
+	AcquireLease(lease lease) (bool, error)
+	FindLease(id string) (*lease, error)
+}
+
+type (
+	game struct {
+		ID          int64     `bson:"_id" json:"id"`
+		SeasonID    string    `bson:"seasonId" json:"seasonId"`
+		Status      string    `bson:"status" json:"status"`       // as given by rapid
+		State       string    `bson:"state" json:"state"`         // one of our game states
+		GameDayID   string    `bson:"gameDayId" json:"gameDayId"` // simple "YYYY-MM-DD" to determine the game's actual date (UTC != PST)
+		SeasonStage string    `bson:"seasonStage" json:"seasonStage"`
+		StartDate   time.Time `bson:"startDate" json:"startDate"`   // UTC
+		WinnerID    int64     `bson:"winnerId" json:"winnerId"`     // id of the winning team
+		Period      int64     `bson:"period" json:"period"`         // the quarter being (or last) played, over 4 in overtime
+		Clock       string    `bson:"clock" json:"clock"`           // time left in the period, while the game is live
+		Overridden  bool      `bson:"overridden" json:"overridden"` // corrected by an admin, so polling leaves it alone
+		HomeTeam    team      `bson:"homeTeam" json:"homeTeam"`
+		AwayTeam    team      `bson:"awayTeam" json:"awayTeam"`
+		Venue       venue     `bson:"venue" json:"venue"`
+	}
+
+	team struct {
+		ID       int64  `bson:"id" json:"id"`
+		Name     string `bson:"name" json:"name"`
+		Nickname string `bson:"nickname" json:"nickname"`
+		Logo     string `bson:"logo" json:"logo"`
+		Score    int64  `bson:"score" json:"score"`
+	}
+
+	venue struct {
+		Name    string `bson:"name" json:"name"`
+		City    string `bson:"city" json:"city"`
+		Country string `bson:"country" json:"country"`
+	}
+
+	gameDayReport struct {
+		ID         string               `bson:"_id" json:"id"`
+		Games      map[int64]gameReport `bson:"games" json:"games"`
+		Deadline   time.Time            `bson:"deadline" json:"deadline"`     // when the first game locks
+		Scoring    string               `bson:"scoring" json:"scoring"`       // taken from the season when the report is created
+		UpsetBonus int64                `bson:"upsetBonus" json:"upsetBonus"` // as are these
+		PickType   string               `bson:"pickType" json:"pickType"`
+		Evaluated  bool                 `bson:"evaluated" json:"evaluated"`
+	}
+
+	gameReport struct {
+		HomeTeam    team       `bson:"homeTeam" json:"homeTeam"`
+		AwayTeam    team       `bson:"awayTeam" json:"awayTeam"`
+		HomeRecord  teamRecord `bson:"homeRecord" json:"homeRecord"` // going into the game
+		AwayRecord  teamRecord `bson:"awayRecord" json:"awayRecord"`
+		Odds        *odds      `bson:"odds,omitempty" json:"odds,omitempty"` // imported by an admin or from the odds file
+		UnderdogID  int64      `bson:"underdogId" json:"underdogId,omitempty"`
+		Venue       venue      `bson:"venue" json:"venue"`
+		Date        time.Time  `bson:"date" json:"date"`
+		LockTime    time.Time  `bson:"lockTime" json:"lockTime"` // picks on the game can't be changed after this
+		Open        bool       `bson:"-" json:"open"`            // worked out when the report is requested
+		State       string     `bson:"state" json:"state"`
+		Period      int64      `bson:"-" json:"period,omitempty"` // taken from the game when the report is requested, as are the scores and state
+		Clock       string     `bson:"-" json:"clock,omitempty"`
+		WinnerID    int64      `bson:"winnerId" json:"winnerId,omitempty"`
+		ATSWinnerID int64      `bson:"atsWinnerId" json:"atsWinnerId,omitempty"` // the team that covered the spread
+	}
+
+	teamRecord struct {
+		Wins   int64 `bson:"wins" json:"wins"`
+		Losses int64 `bson:"losses" json:"losses"`
+	}
+
+	// american moneyline odds, e.g. -150 for the favourite and +130 for the underdog, 0 if not known
+	odds struct {
+		HomeMoneyline int64    `bson:"homeMoneyline" json:"homeMoneyline"`
+		AwayMoneyline int64    `bson:"awayMoneyline" json:"awayMoneyline"`
+		Spread        *float64 `bson:"spread,omitempty" json:"spread,omitempty"` // the home team's, e.g. -5.5 when they're favoured by 5.5
+	}
+
+	gameDayPicks struct {
+		ID        primitive.ObjectID `bson:"_id" json:"id"`
+		UserID    int64              `bson:"userId" json:"userId"`
+		SeasonID  string             `bson:"seasonId" json:"seasonId"`
+		GameDayID string             `bson:"gameDayId" json:"gameDayId"`
+		Picks     map[int64]pick     `bson:"picks" json:"picks"`
+		Evaluated bool               `bson:"evaluated" json:"evaluated"`
+		Score     int64              `bson:"score" json:"score"`
+		Date      time.Time          `bson:"date" json:"date"`
+	}
+
+	pick struct {
+		SelectionID int64   `bson:"selectionId" json:"selectionId"`
+		Confidence  int64   `bson:"confidence" json:"confidence,omitempty"` // only used with confidence scoring
+		Status      string  `bson:"status" json:"status"`
+		Points      *points `bson:"points,omitempty" json:"points,omitempty"` // set once the pick is evaluated
+	}
+
+	// how a pick's score was made up
+	points struct {
+		Base       int64 `bson:"base" json:"base"`
+		UpsetBonus int64 `bson:"upsetBonus" json:"upsetBonus"`
+		Total      int64 `bson:"total" json:"total"`
+	}
+
+	// per season settings, configured by admins
+	season struct {
+		ID         string `bson:"_id" json:"id"`
+		Scoring    string `bson:"scoring" json:"scoring"`
+		UpsetBonus int64  `bson:"upsetBonus" json:"upsetBonus"` // extra points for correctly picking the underdog, 0 to turn off
+		PickType   string `bson:"pickType" json:"pickType"`
+	}
+
+	gameDayResults struct {
+		ID         string   `bson:"_id" json:"id"`
+		UserScores []result `bson:"scores" json:"scores"`
+	}
+
+	leaderboard struct {
+		ID                   string            `bson:"_id" json:"id"` // the specific season
+		Standings            []leaderboardUser `bson:"standings" json:"standings"`
+		LastGameDayEvaluated string            `bson:"lastGameDay" json:"lastGameDay"`
+	}
+
+	leaderboardUser struct {
+		UserID   int64  `bson:"userId" json:"userId"`
+		Username string `bson:"username" json:"username"`
+		Score    int64  `bson:"score" json:"score"`
+	}
+
+	user struct {
+		ID           int64     `bson:"_id" json:"id"`
+		Username     string    `bson:"username" json:"username"`
+		PasswordHash string    `bson:"passwordHash" json:"-"`
+		Role         string    `bson:"role" json:"role"`
+		CreatedAt    time.Time `bson:"createdAt" json:"createdAt"`
+	}
+
+	league struct {
+		ID         string    `bson:"_id" json:"id"`
+		Name       string    `bson:"name" json:"name"`
+		InviteCode string    `bson:"inviteCode" json:"inviteCode"`
+		OwnerID    int64     `bson:"ownerId" json:"ownerId"`
+		Members    []int64   `bson:"members" json:"members"` // user ids, including the owner
+		CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+	}
+
+	// a user's run in the season's survivor pool
+	survivorEntry struct {
+		ID           string                  `bson:"_id" json:"id"` // see survivorEntryID
+		SeasonID     string                  `bson:"seasonId" json:"seasonId"`
+		UserID       int64                   `bson:"userId" json:"userId"`
+		Picks        map[string]survivorPick `bson:"picks" json:"picks"` // game day -> pick
+		EliminatedOn string                  `bson:"eliminatedOn" json:"eliminatedOn,omitempty"`
+	}
+
+	survivorPick struct {
+		GameID int64  `bson:"gameId" json:"gameId"`
+		TeamID int64  `bson:"teamId" json:"teamId"`
+		Status string `bson:"status" json:"status"`
+	}
+
+	// the season's playoff series, set up by an admin
+	bracket struct {
+		ID       string    `bson:"_id" json:"id"`            // the season
+		Deadline time.Time `bson:"deadline" json:"deadline"` // predictions can't be made or changed after this
+		Series   []series  `bson:"series" json:"series"`
+	}
+
+	series struct {
+		ID       string        `bson:"id" json:"id"` // e.g. "east-1-1"
+		Round    int           `bson:"round" json:"round"`
+		BestOf   int           `bson:"bestOf" json:"bestOf"`
+		Teams    [2]int64      `bson:"teams" json:"teams"`     // 0 until decided by the feeder series
+		Feeders  [2]string     `bson:"feeders" json:"feeders"` // the series whose winners meet in this one, empty in the first round
+		Wins     map[int64]int `bson:"wins" json:"wins"`       // team id -> games won
+		WinnerID int64         `bson:"winnerId" json:"winnerId,omitempty"`
+		Games    int           `bson:"games" json:"games,omitempty"` // how long the series went, once decided
+	}
+
+	// a user's predictions for every series in the bracket
+	bracketEntry struct {
+		ID          string                      `bson:"_id" json:"id"` // see bracketEntryID
+		SeasonID    string                      `bson:"seasonId" json:"seasonId"`
+		UserID      int64                       `bson:"userId" json:"userId"`
+		Predictions map[string]seriesPrediction `bson:"predictions" json:"predictions"` // series id -> prediction
+		Score       int64                       `bson:"score" json:"score"`
+	}
+
+	seriesPrediction struct {
+		WinnerID int64  `bson:"winnerId" json:"winnerId"`
+		Games    int    `bson:"games" json:"games"`
+		Status   string `bson:"status" json:"status"`
+		Points   int64  `bson:"points" json:"points"`
+	}
+
+	// requests made to the Rapid API on a day, so the daily budget survives restarts
+	apiUsage struct {
+		ID       string `bson:"_id" json:"id"` // the day (UTC)
+		Requests int    `bson:"requests" json:"requests"`
+	}
+
+	// a Rapid API response for a date, cached so finished dates aren't fetched again
+	apiResponse struct {
+		ID        string    `bson:"_id" json:"id"`    // the date asked for
+		Data      string    `bson:"data" json:"data"` // the response as json
+		FetchedAt time.Time `bson:"fetchedAt" json:"fetchedAt"`
+		Final     bool      `bson:"final" json:"final"`
+	}
+
+	// a run of one of the scheduled jobs, kept as the job history
+	jobRun struct {
+		ID        string        `bson:"_id" json:"id"` // see jobRunID
+		Job       string        `bson:"job" json:"job"`
+		StartedAt time.Time     `bson:"startedAt" json:"startedAt"`
+		Duration  time.Duration `bson:"duration" json:"duration"` // nanoseconds
+		Status    string        `bson:"status" json:"status"`
+		Error     string        `bson:"error" json:"error,omitempty"`
+		Progress  string        `bson:"progress" json:"progress,omitempty"` // how far a job run in the background has got
+	}
+
+	// held by one instance at a time, so that only that instance runs the scheduled jobs
+	lease struct {
+		ID        string    `bson:"_id" json:"id"`
+		Holder    string    `bson:"holder" json:"holder"` // see instanceID
+		RenewedAt time.Time `bson:"renewedAt" json:"renewedAt"`
+		ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+	}
+
+	userScoreOutput struct {
+		ID    int64 `bson:"_id" json:"id"`
+		Score int64 `bson:"score" json:"score"`
+	}
+
+	filter map[string]interface{} // field name -> expected value, e.g. "evaluated" -> true
+)
+
+var (
+	// returned by every Store when a lookup by id finds nothing
+	errNotFound = errors.New("not found")
+)
+
+func setupDatabase() {
+	var err error
+
+	switch config.Config.Database.Backend {
+	case "", "mongo":
+		store, err = newMongoStore(config.Config.Mongo.HostURI, config.Config.Mongo.Name)
+	case "sqlite":
+		store, err = newSQLStore(driverSQLite, config.Config.Database.DSN)
+	case "postgres":
+		store, err = newSQLStore(driverPostgres, config.Config.Database.DSN)
+	default:
+		err = fmt.Errorf("unknown backend %s", config.Config.Database.Backend)
+	}
+
+	if err != nil {
+		log.Fatalf("couldn't set up the database: %s", err.Error())
+	}
+
+	log.Printf("connected to %s database", backendName())
+}
+
+func backendName() string {
+	if config.Config.Database.Backend == "" {
+		return "mongo"
+	}
+
+	return config.Config.Database.Backend
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runs the test against every Store which doesn't need an external database
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	sqliteStore, err := newSQLStore(driverSQLite, ":memory:")
+	assert.Nil(t, err)
+
+	stores := map[string]Store{
+		"memory": newMemoryStore(),
+		"sqlite": sqliteStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			test(t, s)
+		})
+	}
+}
+
+func TestStoreMatches(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		late := game{ID: 2, SeasonID: "2019", GameDayID: "2020-01-18", StartDate: time.Date(2020, time.January, 19, 2, 0, 0, 0, time.UTC)}
+		early := game{ID: 1, SeasonID: "2019", GameDayID: "2020-01-18", StartDate: time.Date(2020, time.January, 18, 20, 30, 0, 0, time.UTC)}
+		other := game{ID: 3, SeasonID: "2019", GameDayID: "2020-01-19", SeasonStage: seasonStagePlayoffs, StartDate: time.Date(2020, time.January, 19, 20, 0, 0, 0, time.UTC)}
+
+		for _, g := range []game{late, early, other} {
+			assert.Nil(t, s.UpsertMatch(g))
+		}
+
+		// upserting again replaces the game
+		late.Status = statusFinished
+		assert.Nil(t, s.UpsertMatch(late))
+
+		games, err := s.FindMatchesByGameDateID("2020-01-18")
+		assert.Nil(t, err)
+
+		// sorted by start date
+		assert.Equal(t, 2, len(games))
+		assert.Equal(t, int64(1), games[0].ID)
+		assert.Equal(t, int64(2), games[1].ID)
+		assert.Equal(t, statusFinished, games[1].Status)
+		assert.Equal(t, early.StartDate, games[0].StartDate)
+
+		assert.Nil(t, s.UpsertMatch(game{ID: 4, SeasonID: "2020", GameDayID: "2020-12-22"}))
+
+		games, err = s.FindMatchesBySeasonID("2019")
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(games))
+		assert.Equal(t, int64(3), games[2].ID)
+
+		games, err = s.FindMatchesBySeasonID("2019", filter{"seasonStage": seasonStagePlayoffs})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(games))
+		assert.Equal(t, int64(3), games[0].ID)
+
+		_, err = s.FindMatchByID(5)
+		assert.True(t, errors.Is(err, errNotFound))
+	})
+}
+
+func TestStorePicks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		picks := gameDayPicks{
+			UserID:    1,
+			SeasonID:  "2019",
+			GameDayID: "2020-01-18",
+			Picks:     createPicks(),
+		}
+
+		assert.Nil(t, s.UpsertGameDayPicks(picks))
+
+		stored, err := s.FindPickReportsByGameDayID("2020-01-18")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(stored))
+		assert.Equal(t, 11, len(stored[0].Picks))
+		assert.False(t, stored[0].ID.IsZero())
+
+		// updating keeps the same document
+		picks.Evaluated = true
+		picks.Score = 7
+		assert.Nil(t, s.UpsertGameDayPicks(picks))
+
+		picks.UserID = 2
+		picks.Evaluated = false
+		picks.Score = 0
+		assert.Nil(t, s.UpsertGameDayPicks(picks))
+
+		evaluated, err := s.FindPickReportsByGameDayID("2020-01-18", filter{"evaluated": true})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(evaluated))
+		assert.Equal(t, stored[0].ID, evaluated[0].ID)
+		assert.Equal(t, int64(7), evaluated[0].Score)
+
+		picks.GameDayID = "2020-01-19"
+		picks.Score = 9
+		assert.Nil(t, s.UpsertGameDayPicks(picks))
+
+		scores, err := s.AggregateUserScoresForSeason("2019")
+		assert.Nil(t, err)
+		assert.Equal(t, []userScoreOutput{{ID: 2, Score: 9}, {ID: 1, Score: 7}}, scores)
+	})
+}
+
+func TestStoreUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		first, err := s.InsertUser(user{Username: "keegan", PasswordHash: "hash", Role: roleAdmin})
+		assert.Nil(t, err)
+
+		second, err := s.InsertUser(user{Username: "colleague"})
+		assert.Nil(t, err)
+		assert.Equal(t, first.ID+1, second.ID)
+
+		_, err = s.InsertUser(user{Username: "keegan"})
+		assert.True(t, errors.Is(err, errUsernameTaken))
+
+		found, err := s.FindUserByUsername("keegan")
+		assert.Nil(t, err)
+		assert.Equal(t, first.ID, found.ID)
+		assert.Equal(t, "hash", found.PasswordHash)
+		assert.Equal(t, roleAdmin, found.Role)
+
+		users, err := s.FindUsersByIDs([]int64{first.ID, second.ID})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(users))
+
+		_, err = s.FindUserByID(100)
+		assert.True(t, errors.Is(err, errNotFound))
+	})
+}
+
+// reopening an existing database shouldn't re-run the migrations, or lose the data
+func TestSQLStoreMigratesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nba.db")
+
+	s, err := newSQLStore(driverSQLite, path)
+	assert.Nil(t, err)
+
+	err = s.UpsertLeaderboard(leaderboard{ID: "2019", LastGameDayEvaluated: "2020-01-18"})
+	assert.Nil(t, err)
+	assert.Nil(t, s.db.Close())
+
+	s, err = newSQLStore(driverSQLite, path)
+	assert.Nil(t, err)
+
+	board, err := s.FindLeaderboardByID("2019")
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-01-18", board.LastGameDayEvaluated)
+}
+
+// the columns added for the results are filled in for rows saved before they were, and kept up to date after
+func TestSQLStoreSeasonStages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nba.db")
+
+	all := migrations
+	migrations = all[:10]
+
+	s, err := newSQLStore(driverSQLite, path)
+	migrations = all
+	assert.Nil(t, err)
+
+	playoffs := game{ID: 1, SeasonID: "2019", GameDayID: "2020-04-18", SeasonStage: seasonStagePlayoffs}
+	data, err := encodeDocument(playoffs)
+	assert.Nil(t, err)
+
+	_, err = s.exec(`INSERT INTO games (id, season_id, game_day_id, start_date, data) VALUES (?, ?, ?, ?, ?)`, playoffs.ID, "2019", "2020-04-18", "2020-04-18T20:30:00Z", data)
+	assert.Nil(t, err)
+	assert.Nil(t, s.db.Close())
+
+	// the games already saved are filled in by the migration
+	s, err = newSQLStore(driverSQLite, path)
+	assert.Nil(t, err)
+
+	games, err := s.FindMatchesBySeasonID("2019", filter{"seasonStage": seasonStagePlayoffs})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(games))
+
+	_, err = s.FindMatchesBySeasonID("2019", filter{"state": stateFinished})
+	assert.NotNil(t, err)
+}
+
+func TestStoreLeagues(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		office := league{ID: "a1", Name: "Office", InviteCode: "ABCD2345", OwnerID: 1, Members: []int64{1}}
+		assert.Nil(t, s.InsertLeague(office))
+
+		// ids and invite codes are unique
+		err := s.InsertLeague(league{ID: "a2", Name: "Other", InviteCode: "ABCD2345", OwnerID: 2, Members: []int64{2}})
+		assert.True(t, errors.Is(err, errLeagueExists))
+
+		assert.Nil(t, s.AddLeagueMember("a1", 2))
+		assert.Nil(t, s.AddLeagueMember("a1", 2)) // joining twice is a no-op
+		assert.True(t, errors.Is(s.AddLeagueMember("b1", 2), errNotFound))
+
+		found, err := s.FindLeagueByInviteCode("ABCD2345")
+		assert.Nil(t, err)
+		assert.Equal(t, "Office", found.Name)
+		assert.ElementsMatch(t, []int64{1, 2}, found.Members)
+
+		leagues, err := s.FindLeaguesByMember(2)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(leagues))
+		assert.Equal(t, "a1", leagues[0].ID)
+
+		leagues, err = s.FindLeaguesByMember(3)
+		assert.Nil(t, err)
+		assert.Empty(t, leagues)
+
+		_, err = s.FindLeagueByID("b1")
+		assert.True(t, errors.Is(err, errNotFound))
+	})
+}
+
+func TestStoreSurvivorEntries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		for _, userID := range []int64{2, 1} {
+			assert.Nil(t, s.UpsertSurvivorEntry(survivorEntry{
+				ID:       survivorEntryID("2019", userID),
+				SeasonID: "2019",
+				UserID:   userID,
+				Picks:    map[string]survivorPick{"2020-01-18": {GameID: 7015, TeamID: 23, Status: pickPending}},
+			}))
+		}
+
+		entry, err := s.FindSurvivorEntry("2019", 1)
+		assert.Nil(t, err)
+
+		entry.EliminatedOn = "2020-01-18"
+		assert.Nil(t, s.UpsertSurvivorEntry(*entry))
+
+		entries, err := s.FindSurvivorEntriesBySeasonID("2019")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(entries))
+		assert.Equal(t, "2020-01-18", entries[0].EliminatedOn)
+		assert.Equal(t, int64(23), entries[1].Picks["2020-01-18"].TeamID)
+
+		_, err = s.FindSurvivorEntry("2020", 1)
+		assert.True(t, errors.Is(err, errNotFound))
+	})
+}
+
+func TestStoreAPIResponses(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		fetchedAt := time.Date(2020, time.January, 18, 12, 0, 0, 0, time.UTC)
+
+		assert.Nil(t, s.UpsertAPIUsage(apiUsage{ID: "2020-01-18", Requests: 3}))
+		assert.Nil(t, s.UpsertAPIResponse(apiResponse{ID: "2020-01-18", Data: `{"api":{"status":200}}`, FetchedAt: fetchedAt}))
+		assert.Nil(t, s.UpsertAPIResponse(apiResponse{ID: "2020-01-18", Data: `{"api":{"status":200}}`, FetchedAt: fetchedAt, Final: true}))
+
+		usage, err := s.FindAPIUsage("2020-01-18")
+		assert.Nil(t, err)
+		assert.Equal(t, 3, usage.Requests)
+
+		response, err := s.FindAPIResponse("2020-01-18")
+		assert.Nil(t, err)
+		assert.True(t, response.Final)
+		assert.True(t, fetchedAt.Equal(response.FetchedAt))
+
+		_, err = s.FindAPIUsage("2020-01-19")
+		assert.True(t, errors.Is(err, errNotFound))
+
+		_, err = s.FindAPIResponse("2020-01-19")
+		assert.True(t, errors.Is(err, errNotFound))
+	})
+}
+
+func TestStoreUpsertMatches(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		assert.Nil(t, s.UpsertMatches(nil))
+
+		assert.Nil(t, s.UpsertMatches([]game{
+			{ID: 1, SeasonID: "2019", GameDayID: "2020-01-18", Status: "Scheduled"},
+			{ID: 2, SeasonID: "2019", GameDayID: "2020-01-18", Status: "Scheduled"},
+		}))
+
+		assert.Nil(t, s.UpsertMatches([]game{{ID: 2, SeasonID: "2019", GameDayID: "2020-01-18", Status: statusFinished}}))
+
+		games, err := s.FindMatchesByGameDateID("2020-01-18")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(games))
+		assert.Equal(t, statusFinished, games[1].Status)
+	})
+}
+
+func TestStoreLeases(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		now := time.Date(2020, time.January, 18, 12, 0, 0, 0, time.UTC)
+		claim := func(holder string, at time.Time) lease {
+			return lease{ID: schedulerLease, Holder: holder, RenewedAt: at, ExpiresAt: at.Add(30 * time.Second)}
+		}
+
+		_, err := s.FindLease(schedulerLease)
+		assert.True(t, errors.Is(err, errNotFound))
+
+		acquired, err := s.AcquireLease(claim("a", now))
+		assert.Nil(t, err)
+		assert.True(t, acquired)
+
+		// held by a until it expires, though a can renew it
+		acquired, err = s.AcquireLease(claim("b", now.Add(10*time.Second)))
+		assert.Nil(t, err)
+		assert.False(t, acquired)
+
+		acquired, err = s.AcquireLease(claim("a", now.Add(20*time.Second)))
+		assert.Nil(t, err)
+		assert.True(t, acquired)
+
+		acquired, err = s.AcquireLease(claim("b", now.Add(40*time.Second)))
+		assert.Nil(t, err)
+		assert.False(t, acquired)
+
+		acquired, err = s.AcquireLease(claim("b", now.Add(50*time.Second)))
+		assert.Nil(t, err)
+		assert.True(t, acquired)
+
+		held, err := s.FindLease(schedulerLease)
+		assert.Nil(t, err)
+		assert.Equal(t, "b", held.Holder)
+		assert.True(t, now.Add(80*time.Second).Equal(held.ExpiresAt))
+	})
+}
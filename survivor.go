@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	"sort"
+)
+
+type (
+	survivorStatus struct {
+		UserID       int64  `json:"userId"`
+		Username     string `json:"username"`
+		Survived     int    `json:"survived"` // game days won
+		EliminatedOn string `json:"eliminatedOn,omitempty"`
+	}
+
+	survivorStandings struct {
+		Season     string           `json:"season"`
+		Alive      []survivorStatus `json:"alive"`
+		Eliminated []survivorStatus `json:"eliminated"` // most recently eliminated first
+	}
+)
+
+var (
+	errEliminated = errors.New("already eliminated from the survivor pool")
+)
+
+func survivorEntryID(seasonID string, userID int64) string {
+	return fmt.Sprintf("%s:%d", seasonID, userID)
+}
+
+// the user's entry for the season, or a fresh one if they haven't made a survivor pick yet
+func findSurvivorEntry(seasonID string, userID int64) (*survivorEntry, error) {
+	entry, err := store.FindSurvivorEntry(seasonID, userID)
+
+	if errors.Is(err, errNotFound) {
+		return &survivorEntry{
+			ID:       survivorEntryID(seasonID, userID),
+			SeasonID: seasonID,
+			UserID:   userID,
+			Picks:    map[string]survivorPick{},
+		}, nil
+	}
+
+	return entry, err
+}
+
+// checks the user's survivor pick against the game day, then saves it on their entry
+// a team can only be picked once a season, unless the game it was picked for was void
+func saveSurvivorPick(userID int64, payload survivorPickPayload) (*survivorEntry, error) {
+	report, err := store.FindGameDayReportByID(payload.GameDayID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := findSurvivorEntry(config.Config.Rapid.Season, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.EliminatedOn != "" {
+		return nil, errEliminated
+	}
+
+	now := clock.Now()
+
+	if existing, ok := entry.Picks[payload.GameDayID]; ok && report.Games[existing.GameID].isLocked(now) {
+		return nil, fmt.Errorf("survivor pick for %s locked at %v", payload.GameDayID, report.Games[existing.GameID].LockTime)
+	}
+
+	var gameID int64
+	for id, game := range report.Games {
+		if game.HomeTeam.ID == payload.TeamID || game.AwayTeam.ID == payload.TeamID {
+			gameID = id
+		}
+	}
+
+	if gameID == 0 {
+		return nil, fmt.Errorf("team %d is not playing on game day %s", payload.TeamID, payload.GameDayID)
+	}
+
+	if game := report.Games[gameID]; game.isLocked(now) {
+		return nil, fmt.Errorf("game %d locked at %v", gameID, game.LockTime)
+	}
+
+	for date, p := range entry.Picks {
+		if date != payload.GameDayID && p.TeamID == payload.TeamID && p.Status != pickVoid {
+			return nil, fmt.Errorf("team %d was already picked on %s", payload.TeamID, date)
+		}
+	}
+
+	entry.Picks[payload.GameDayID] = survivorPick{
+		GameID: gameID,
+		TeamID: payload.TeamID,
+		Status: pickPending,
+	}
+
+	err = store.UpsertSurvivorEntry(*entry)
+	return entry, err
+}
+
+// marks the season's survivor picks for the evaluated game day, eliminating everyone whose team lost
+// users who didn't pick on the game day aren't eliminated, they just don't survive another day
+// picks are scored again if the game day is evaluated again, e.g. after a result was corrected
+func evaluateSurvivorPicks(report gameDayReport, seasonID string) error {
+	entries, err := store.FindSurvivorEntriesBySeasonID(seasonID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		p, ok := entry.Picks[report.ID]
+
+		if !ok {
+			continue
+		}
+
+		// picks made after going out, before the earlier game day was evaluated, don't count
+		if entry.EliminatedOn != "" && entry.EliminatedOn < report.ID {
+			continue
+		}
+
+		winnerID := report.Games[p.GameID].WinnerID
+
+		switch {
+		case winnerID == 0:
+			p.Status = pickVoid
+		case winnerID == p.TeamID:
+			p.Status = pickCorrect
+		default:
+			p.Status = pickIncorrect
+		}
+
+		entry.Picks[report.ID] = p
+		entry.EliminatedOn = firstIncorrectPick(entry)
+
+		if err := store.UpsertSurvivorEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// the game day of the entry's earliest incorrect pick, or "" if it's still alive
+func firstIncorrectPick(entry survivorEntry) string {
+	first := ""
+
+	for date, p := range entry.Picks {
+		if p.Status == pickIncorrect && (first == "" || date < first) {
+			first = date
+		}
+	}
+
+	return first
+}
+
+// who is still alive in the season's survivor pool, and who went out when
+func findSurvivorStandings(seasonID string) (*survivorStandings, error) {
+	entries, err := store.FindSurvivorEntriesBySeasonID(seasonID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []int64
+	for _, entry := range entries {
+		userIDs = append(userIDs, entry.UserID)
+	}
+
+	usernames, err := usernamesByID(userIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	standings := survivorStandings{
+		Season:     seasonID,
+		Alive:      []survivorStatus{},
+		Eliminated: []survivorStatus{},
+	}
+
+	for _, entry := range entries {
+		status := survivorStatus{
+			UserID:       entry.UserID,
+			Username:     usernames[entry.UserID],
+			EliminatedOn: entry.EliminatedOn,
+		}
+
+		// game days can be evaluated out of order, so wins after the elimination don't count
+		for date, p := range entry.Picks {
+			if p.Status == pickCorrect && (entry.EliminatedOn == "" || date < entry.EliminatedOn) {
+				status.Survived++
+			}
+		}
+
+		if entry.EliminatedOn == "" {
+			standings.Alive = append(standings.Alive, status)
+		} else {
+			standings.Eliminated = append(standings.Eliminated, status)
+		}
+	}
+
+	sort.SliceStable(standings.Alive, func(i, j int) bool {
+		return standings.Alive[i].Survived > standings.Alive[j].Survived
+	})
+
+	sort.SliceStable(standings.Eliminated, func(i, j int) bool {
+		return standings.Eliminated[i].EliminatedOn > standings.Eliminated[j].EliminatedOn
+	})
+
+	return &standings, nil
+}
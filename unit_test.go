@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
+	"nba-pick-and-play/config"
+	clockPkg "nba-pick-and-play/pkg/clock"
 	"nba-pick-and-play/pkg/rapid"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,7 +20,7 @@ func TestPollGamesSuccess(t *testing.T) {
 	assert.Nil(t, err)
 
 	// check if parsing was genuinely successful
-	matches, err := findMatchesByGameDateID("2020-01-18")
+	matches, err := store.FindMatchesByGameDateID("2020-01-18")
 	assert.Nil(t, err)
 
 	assert.NotNil(t, matches)
@@ -39,7 +43,7 @@ func TestPollGamesSuccess(t *testing.T) {
 	assert.Equal(t, int64(7016), matches[1].ID)
 
 	// check that parsing for games that took place on the previous day worked too
-	matches, err = findMatchesByGameDateID("2020-01-17")
+	matches, err = store.FindMatchesByGameDateID("2020-01-17")
 	assert.Nil(t, err)
 
 	assert.NotNil(t, matches)
@@ -56,7 +60,7 @@ func TestCreateGameDayReportSuccess(t *testing.T) {
 	_, err = createGameDayReport("2020-01-18")
 	assert.Nil(t, err)
 
-	report, err := findGameDayReportByID("2020-01-18")
+	report, err := store.FindGameDayReportByID("2020-01-18")
 	assert.Nil(t, err)
 
 	assert.NotNil(t, report)
@@ -87,7 +91,7 @@ func TestEvaluateGameDayReportSuccess(t *testing.T) {
 		Date:      clock.Now(),
 	}
 
-	err = upsertGameDayPicks(gameDayPicks)
+	err = store.UpsertGameDayPicks(gameDayPicks)
 	assert.Nil(t, err)
 
 	// substitute the client again, this time for one with the results data
@@ -106,7 +110,7 @@ func TestEvaluateGameDayReportSuccess(t *testing.T) {
 	assert.Nil(t, err)
 
 	// check the games have been updated
-	matches, err := findMatchesByGameDateID("2020-01-18")
+	matches, err := store.FindMatchesByGameDateID("2020-01-18")
 	assert.Nil(t, err)
 
 	for _, m := range matches {
@@ -119,10 +123,11 @@ func TestEvaluateGameDayReportSuccess(t *testing.T) {
 	}
 
 	// evaluate the game day report
-	err = evaluateGameDayReport("2020-01-18")
+	evaluated, err := evaluateGameDayReport("2020-01-18")
 	assert.Nil(t, err)
+	assert.Equal(t, 1, evaluated)
 
-	report, err := findGameDayReportByID("2020-01-18")
+	report, err := store.FindGameDayReportByID("2020-01-18")
 	assert.Nil(t, err)
 	assert.True(t, report.Evaluated)
 
@@ -133,7 +138,7 @@ func TestEvaluateGameDayReportSuccess(t *testing.T) {
 	}
 
 	// check the user picks
-	pickReports, err := findPickReportsByGameDayID("2020-01-18")
+	pickReports, err := store.FindPickReportsByGameDayID("2020-01-18")
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(pickReports))
 
@@ -162,24 +167,24 @@ func TestCreateGameDayResultsReportSuccess(t *testing.T) {
 		Score:     7,
 	}
 
-	err = upsertGameDayPicks(picks)
+	err = store.UpsertGameDayPicks(picks)
 	assert.Nil(t, err)
 
 	picks.UserID = 67890
 	picks.Score = 9
 
-	err = upsertGameDayPicks(picks)
+	err = store.UpsertGameDayPicks(picks)
 	assert.Nil(t, err)
 
 	picks.UserID = 13579
 	picks.Score = 4
 
-	err = upsertGameDayPicks(picks)
+	err = store.UpsertGameDayPicks(picks)
 	assert.Nil(t, err)
 
 	createGameDayResults("2020-01-18")
 
-	report, err := findGameDayResultsReportByID("2020-01-18")
+	report, err := store.FindGameDayResultsReportByID("2020-01-18")
 	assert.Nil(t, err)
 
 	assert.Equal(t, "2020-01-18", report.ID)
@@ -207,38 +212,38 @@ func TestUpdateLeaderboard(t *testing.T) {
 		Score:     7,
 	}
 
-	err := upsertGameDayPicks(picks)
+	err := store.UpsertGameDayPicks(picks)
 	assert.Nil(t, err)
 
 	picks.GameDayID = "2020-01-19"
 	picks.Score = 9
 
-	err = upsertGameDayPicks(picks)
+	err = store.UpsertGameDayPicks(picks)
 	assert.Nil(t, err)
 
 	picks.GameDayID = "2020-01-20"
 	picks.Score = 4
 
-	err = upsertGameDayPicks(picks)
+	err = store.UpsertGameDayPicks(picks)
 	assert.Nil(t, err)
 
 	//... and some more for mock user 67890
 	picks.UserID = 67890
 	picks.Score = 4
 
-	err = upsertGameDayPicks(picks)
+	err = store.UpsertGameDayPicks(picks)
 	assert.Nil(t, err)
 
 	picks.GameDayID = "2020-01-19"
 	picks.Score = 7
 
-	err = upsertGameDayPicks(picks)
+	err = store.UpsertGameDayPicks(picks)
 	assert.Nil(t, err)
 
-	err = updateLeaderboard("2019")
+	err = updateLeaderboard("2019", "2020-01-18")
 	assert.Nil(t, err)
 
-	board, err := findLeaderboardByID("2019")
+	board, err := store.FindLeaderboardByID("2019")
 	assert.Nil(t, err)
 
 	assert.NotNil(t, board)
@@ -250,4 +255,817 @@ func TestUpdateLeaderboard(t *testing.T) {
 
 	assert.Equal(t, int64(67890), board.Standings[1].UserID)
 	assert.Equal(t, int64(11), board.Standings[1].Score)
+	assert.Equal(t, "2020-01-18", board.LastGameDayEvaluated)
+
+	// rebuilding the leaderboard on its own keeps the last game day evaluated
+	err = updateLeaderboard("2019", "")
+	assert.Nil(t, err)
+
+	board, err = store.FindLeaderboardByID("2019")
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-01-18", board.LastGameDayEvaluated)
+}
+
+func TestAuthenticateUser(t *testing.T) {
+	defer cleanDatabase(t)
+
+	created := createUser(t, "Keegan")
+	assert.Equal(t, "keegan", created.Username)
+
+	user, err := authenticateUser("KEEGAN", "password123")
+	assert.Nil(t, err)
+	assert.Equal(t, created.ID, user.ID)
+
+	_, err = authenticateUser("keegan", "wrongpassword")
+	assert.True(t, errors.Is(err, errInvalidCredentials))
+
+	_, err = authenticateUser("nobody", "password123")
+	assert.True(t, errors.Is(err, errInvalidCredentials))
+
+	// user ids are handed out in order
+	other := createUser(t, "colleague")
+	assert.Equal(t, created.ID+1, other.ID)
+}
+
+func TestGameStateFromStatus(t *testing.T) {
+	assert.Equal(t, stateScheduled, gameStateFromStatus("Scheduled"))
+	assert.Equal(t, stateLive, gameStateFromStatus("In Play"))
+	assert.Equal(t, stateFinished, gameStateFromStatus("Finished"))
+	assert.Equal(t, statePostponed, gameStateFromStatus("Postponed"))
+	assert.Equal(t, stateCancelled, gameStateFromStatus("Canceled"))
+	assert.Equal(t, stateCancelled, gameStateFromStatus("Cancelled"))
+
+	// nobody wins a game that ended level (or never started)
+	assert.Zero(t, determineWinner(team{ID: 1}, team{ID: 2}))
+	assert.Equal(t, int64(2), determineWinner(team{ID: 1, Score: 99}, team{ID: 2, Score: 100}))
+}
+
+func TestRapidGameToGameWinner(t *testing.T) {
+	// the winner follows the state, so a status in another case still decides the game
+	game, err := rapidGameToGame(rapid.NBAGame{
+		GameID:     "7015",
+		StatusGame: "finished",
+		HTeam:      rapid.NBATeam{TeamID: "23", Score: rapid.Score{Points: "101"}},
+		VTeam:      rapid.NBATeam{TeamID: "16", Score: rapid.Score{Points: "99"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, stateFinished, game.State)
+	assert.Equal(t, int64(23), game.WinnerID)
+}
+
+func TestEvaluateGameDayReportDeferredUntilFinal(t *testing.T) {
+	defer cleanDatabase(t)
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	// none of the games have been played yet
+	_, err = evaluateGameDayReport("2020-01-18")
+	assert.True(t, errors.Is(err, errGameDayNotFinal))
+
+	report, err := store.FindGameDayReportByID("2020-01-18")
+	assert.Nil(t, err)
+	assert.False(t, report.Evaluated)
+}
+
+func TestEvaluateGameDayReportGamesWithoutState(t *testing.T) {
+	defer cleanDatabase(t)
+	defer setDefaultMockRapidAPIClient()
+
+	rapidAPIClient = rapid.NewMockRapidClient(map[string]string{
+		"2020-01-18": "test/2020-01-18_nextday.json",
+		"2020-01-19": "test/2020-01-19_nextday.json",
+	})
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	// saved before games had a state
+	games, err := store.FindMatchesByGameDateID("2020-01-18")
+	assert.Nil(t, err)
+
+	for _, g := range games {
+		g.State = ""
+		assert.Nil(t, store.UpsertMatch(g))
+	}
+
+	_, err = evaluateGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	report, err := store.FindGameDayReportByID("2020-01-18")
+	assert.Nil(t, err)
+	assert.True(t, report.Evaluated)
+	assert.Equal(t, stateFinished, report.Games[7015].State)
+	assert.Equal(t, int64(16), report.Games[7015].WinnerID)
+}
+
+func TestEvaluateGameDayReportVoidsPostponedGames(t *testing.T) {
+	defer cleanDatabase(t)
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	err = store.UpsertGameDayPicks(gameDayPicks{
+		UserID:    12345,
+		GameDayID: "2020-01-18",
+		Picks:     createPicks(),
+	})
+	assert.Nil(t, err)
+
+	rapidAPIClient = rapid.NewMockRapidClient(map[string]string{
+		"2020-01-18": "test/2020-01-18_nextday.json",
+		"2020-01-19": "test/2020-01-19_nextday.json",
+	})
+
+	defer setDefaultMockRapidAPIClient()
+
+	err = pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	// Pelicans @ Clippers was postponed...
+	postponed, err := store.FindMatchByID(7015)
+	assert.Nil(t, err)
+
+	postponed.Status = "Postponed"
+	postponed.State = statePostponed
+	postponed.HomeTeam.Score = 0
+	postponed.AwayTeam.Score = 0
+	postponed.WinnerID = 0
+	assert.Nil(t, store.UpsertMatch(*postponed))
+
+	// ...and Bucks @ Nets was cancelled (the pick on the Bucks was correct in the real result)
+	cancelled, err := store.FindMatchByID(7016)
+	assert.Nil(t, err)
+
+	cancelled.State = stateCancelled
+	assert.Nil(t, store.UpsertMatch(*cancelled))
+
+	_, err = evaluateGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	report, err := store.FindGameDayReportByID("2020-01-18")
+	assert.Nil(t, err)
+	assert.Zero(t, report.Games[7015].WinnerID)
+	assert.Equal(t, statePostponed, report.Games[7015].State)
+
+	pickReports, err := store.FindPickReportsByGameDayID("2020-01-18")
+	assert.Nil(t, err)
+
+	rep := pickReports[0]
+	assert.Equal(t, pickVoid, rep.Picks[7015].Status)
+	assert.Equal(t, pickVoid, rep.Picks[7016].Status)
+
+	// the 7 correct picks less the one on the cancelled game
+	assert.Equal(t, int64(6), rep.Score)
+}
+
+func TestEvaluateUserPicksConfidenceScoring(t *testing.T) {
+	report := gameDayReport{
+		ID:      "2020-01-18",
+		Scoring: scoringConfidence,
+		Games: map[int64]gameReport{
+			1: {WinnerID: 10},
+			2: {WinnerID: 20},
+			3: {WinnerID: 30},
+			4: {}, // postponed
+		},
+	}
+
+	picksReport := gameDayPicks{
+		Picks: map[int64]pick{
+			1: {SelectionID: 10, Confidence: 4, Status: pickPending},
+			2: {SelectionID: 21, Confidence: 3, Status: pickPending},
+			3: {SelectionID: 30, Confidence: 1, Status: pickPending},
+			4: {SelectionID: 40, Confidence: 2, Status: pickPending},
+		},
+	}
+
+	evaluated := evaluateUserPicks(report, picksReport)
+
+	// the confidence of the two correct picks, the void game doesn't count
+	assert.Equal(t, int64(5), evaluated.Score)
+	assert.Equal(t, pickVoid, evaluated.Picks[4].Status)
+
+	// the same picks are worth a point each with standard scoring
+	report.Scoring = scoringStandard
+	picksReport.Evaluated = false
+
+	evaluated = evaluateUserPicks(report, picksReport)
+	assert.Equal(t, int64(2), evaluated.Score)
+}
+
+func TestFindUnderdog(t *testing.T) {
+	home, away := team{ID: 1}, team{ID: 2}
+
+	tests := []struct {
+		name       string
+		homeRecord teamRecord
+		awayRecord teamRecord
+		odds       *odds
+		expected   int64
+	}{
+		{"worse record", teamRecord{Wins: 10, Losses: 30}, teamRecord{Wins: 25, Losses: 15}, nil, 1},
+		{"better win percentage with fewer wins", teamRecord{Wins: 9, Losses: 1}, teamRecord{Wins: 20, Losses: 20}, nil, 2},
+		{"same win percentage", teamRecord{Wins: 5, Losses: 5}, teamRecord{Wins: 10, Losses: 10}, nil, 0},
+		{"no games played", teamRecord{}, teamRecord{Wins: 1}, nil, 0},
+		{"odds beat records", teamRecord{Wins: 10, Losses: 30}, teamRecord{Wins: 25, Losses: 15}, &odds{HomeMoneyline: -120, AwayMoneyline: 110}, 2},
+		{"even odds", teamRecord{}, teamRecord{}, &odds{HomeMoneyline: -110, AwayMoneyline: -110}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := gameReport{
+				HomeTeam:   home,
+				AwayTeam:   away,
+				HomeRecord: test.homeRecord,
+				AwayRecord: test.awayRecord,
+				Odds:       test.odds,
+			}
+
+			assert.Equal(t, test.expected, findUnderdog(game))
+		})
+	}
+}
+
+func TestEvaluateUserPicksUpsetBonus(t *testing.T) {
+	report := gameDayReport{
+		ID:         "2020-01-18",
+		Scoring:    scoringConfidence,
+		UpsetBonus: 2,
+		Games: map[int64]gameReport{
+			1: {WinnerID: 10, UnderdogID: 10},
+			2: {WinnerID: 20, UnderdogID: 21},
+			3: {WinnerID: 30, UnderdogID: 30},
+		},
+	}
+
+	picksReport := gameDayPicks{
+		Picks: map[int64]pick{
+			1: {SelectionID: 10, Confidence: 1, Status: pickPending},
+			2: {SelectionID: 20, Confidence: 3, Status: pickPending},
+			3: {SelectionID: 31, Confidence: 2, Status: pickPending},
+		},
+	}
+
+	evaluated := evaluateUserPicks(report, picksReport)
+
+	assert.Equal(t, int64(6), evaluated.Score)
+	assert.Equal(t, points{Base: 1, UpsetBonus: 2, Total: 3}, *evaluated.Picks[1].Points)
+	assert.Equal(t, points{Base: 3, Total: 3}, *evaluated.Picks[2].Points)
+	assert.Equal(t, points{}, *evaluated.Picks[3].Points) // backing the underdog only pays if they win
+}
+
+func TestCreateGameDayReportUnderdogFromRecords(t *testing.T) {
+	defer cleanDatabase(t)
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	// two earlier results between the teams playing in 7015, both won by the away side
+	for i, date := range []string{"2020-01-10", "2020-01-14"} {
+		err = store.UpsertMatch(game{
+			ID:        int64(6000 + i),
+			SeasonID:  "2019",
+			State:     stateFinished,
+			GameDayID: date,
+			StartDate: time.Date(2020, 1, 10+4*i, 0, 0, 0, 0, time.UTC),
+			WinnerID:  16,
+			HomeTeam:  team{ID: 23},
+			AwayTeam:  team{ID: 16},
+		})
+		assert.Nil(t, err)
+	}
+
+	report, err := createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	game := report.Games[7015]
+	assert.Equal(t, teamRecord{Losses: 2}, game.HomeRecord)
+	assert.Equal(t, teamRecord{Wins: 2}, game.AwayRecord)
+	assert.Equal(t, int64(23), game.UnderdogID)
+
+	// later games don't count towards the record
+	assert.Equal(t, teamRecord{}, report.Games[7016].HomeRecord)
+	assert.Equal(t, int64(0), report.Games[7016].UnderdogID)
+}
+
+func TestDetermineSpreadWinner(t *testing.T) {
+	home, away := team{ID: 1, Score: 100}, team{ID: 2, Score: 95}
+
+	assert.Equal(t, int64(1), determineSpreadWinner(home, away, -4.5))
+	assert.Equal(t, int64(2), determineSpreadWinner(home, away, -5.5))
+	assert.Zero(t, determineSpreadWinner(home, away, -5)) // push
+
+	// the home side here is getting 7 and lost by 5
+	assert.Equal(t, int64(2), determineSpreadWinner(away, home, 7))
+}
+
+func TestEvaluateGameDayReportAgainstTheSpread(t *testing.T) {
+	defer cleanDatabase(t)
+
+	config.Config.Odds.File = "test/odds.json"
+	defer func() { config.Config.Odds.File = "" }()
+
+	err := store.UpsertSeason(season{ID: "2019", Scoring: scoringStandard, PickType: pickTypeSpread})
+	assert.Nil(t, err)
+
+	err = pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	report, err := createGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, pickTypeSpread, report.PickType)
+	assert.Equal(t, 3.0, *report.Games[7015].Odds.Spread)
+	assert.Nil(t, report.Games[7018].Odds)
+
+	err = store.UpsertGameDayPicks(gameDayPicks{
+		UserID:    12345,
+		GameDayID: "2020-01-18",
+		Picks: map[int64]pick{
+			7015: {SelectionID: 23, Status: pickPending},
+			7016: {SelectionID: 4, Status: pickPending},
+			7017: {SelectionID: 2, Status: pickPending},
+		},
+	})
+	assert.Nil(t, err)
+
+	rapidAPIClient = rapid.NewMockRapidClient(map[string]string{
+		"2020-01-18": "test/2020-01-18_nextday.json",
+		"2020-01-19": "test/2020-01-19_nextday.json",
+	})
+
+	defer setDefaultMockRapidAPIClient()
+
+	err = pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	_, err = evaluateGameDayReport("2020-01-18")
+	assert.Nil(t, err)
+
+	report, err = store.FindGameDayReportByID("2020-01-18")
+	assert.Nil(t, err)
+
+	// the Clippers lost by 3 getting 3 points, the Nets lost by 20 getting 25, and the Celtics lost by 4 giving 2.5
+	assert.Zero(t, report.Games[7015].ATSWinnerID)
+	assert.Equal(t, int64(4), report.Games[7016].ATSWinnerID)
+	assert.Equal(t, int64(28), report.Games[7017].ATSWinnerID)
+	assert.Equal(t, int64(21), report.Games[7016].WinnerID)
+
+	pickReports, err := store.FindPickReportsByGameDayID("2020-01-18")
+	assert.Nil(t, err)
+
+	rep := pickReports[0]
+	assert.Equal(t, pickVoid, rep.Picks[7015].Status)
+	assert.Equal(t, pickCorrect, rep.Picks[7016].Status)
+	assert.Equal(t, pickIncorrect, rep.Picks[7017].Status)
+	assert.Equal(t, int64(1), rep.Score)
+}
+
+func TestScoreBracketEntry(t *testing.T) {
+	b := bracket{
+		Series: []series{
+			{ID: "west", Round: 1, BestOf: 7, WinnerID: 23, Games: 6},
+			{ID: "east", Round: 1, BestOf: 7, WinnerID: 21, Games: 4},
+			{ID: "final", Round: 2, BestOf: 7, WinnerID: 21, Games: 7},
+		},
+	}
+
+	entry := bracketEntry{
+		Predictions: map[string]seriesPrediction{
+			"west":  {WinnerID: 16, Games: 6},
+			"east":  {WinnerID: 21, Games: 5},
+			"final": {WinnerID: 21, Games: 7},
+		},
+	}
+
+	scored := scoreBracketEntry(b, entry)
+
+	assert.Equal(t, pickIncorrect, scored.Predictions["west"].Status)
+	assert.Zero(t, scored.Predictions["west"].Points) // the right length doesn't count with the wrong winner
+	assert.Equal(t, int64(1), scored.Predictions["east"].Points)
+	assert.Equal(t, int64(3), scored.Predictions["final"].Points)
+	assert.Equal(t, int64(4), scored.Score)
+}
+
+func TestCachedPollGames(t *testing.T) {
+	defer cleanDatabase(t)
+	defer setDefaultMockRapidAPIClient()
+
+	rapidAPIClient = rapid.NewCachingClient(rapidAPIClient, apiResponseCache{}, 0, clock)
+
+	err := pollGames("2020-01-18")
+	assert.Nil(t, err)
+
+	polled, err := store.FindMatchesByGameDateID("2020-01-18")
+	assert.Nil(t, err)
+
+	cached, err := apiResponseCache{}.LoadResponse("2020-01-18")
+	assert.Nil(t, err)
+	assert.False(t, cached.Final)
+
+	// served from the cache once the mock has nothing for the date, as long as the games have finished
+	cached.Final = true
+	err = apiResponseCache{}.SaveResponse(*cached)
+	assert.Nil(t, err)
+
+	rapidAPIClient = rapid.NewCachingClient(rapid.NewMockRapidClient(nil), apiResponseCache{}, 0, clock)
+
+	err = pollGames("2020-01-18")
+	assert.Nil(t, err)
+
+	games, err := store.FindMatchesByGameDateID("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, polled, games)
+}
+
+func TestSetupRapidClientReplay(t *testing.T) {
+	defer cleanDatabase(t)
+	defer setDefaultMockRapidAPIClient()
+
+	rapidConfig := config.Config.Rapid
+	defer func() {
+		config.Config.Rapid = rapidConfig
+	}()
+
+	config.Config.Rapid.Mode = "backwards"
+	assert.NotNil(t, setupRapidClient())
+
+	// the test files are in the same format as recorded fixtures
+	config.Config.Rapid.Mode = rapidModeReplay
+	config.Config.Rapid.FixturesDir = "test"
+	assert.Nil(t, setupRapidClient())
+	assert.Nil(t, rapidLimiter)
+
+	err := pollGames("2020-01-18", "2020-01-19")
+	assert.Nil(t, err)
+
+	games, err := store.FindMatchesByGameDateID("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, 11, len(games))
+
+	err = pollGames("2020-01-20")
+	assert.True(t, errors.Is(err, rapid.ErrNoFixture))
+}
+
+func TestFileProvider(t *testing.T) {
+	for _, path := range []string{"test/schedule.csv", "test/schedule.json"} {
+		games, err := fileProvider{path: path}.GamesByDate("2020-01-18")
+		assert.Nil(t, err, path)
+
+		finished := games[0]
+		assert.Equal(t, int64(9001), finished.ID)
+		assert.Equal(t, "2020-01-17", finished.GameDayID) // 7:30pm eastern
+		assert.Equal(t, stateFinished, finished.State)
+		assert.Equal(t, int64(1), finished.WinnerID)
+		assert.Equal(t, "Boston Celtics", finished.AwayTeam.Name)
+		assert.Equal(t, "State Farm Arena", finished.Venue.Name)
+	}
+
+	games, err := fileProvider{path: "test/schedule.csv"}.GamesByDate("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(games))
+	assert.Equal(t, stateScheduled, games[1].State)
+	assert.Equal(t, "2020-01-18", games[1].GameDayID)
+
+	_, err = readScheduleCSV(strings.NewReader("id,season,start,status,homeId,homeName,awayId,awayName,venue\n"))
+	assert.True(t, errors.Is(err, errInvalidScheduleFile))
+	assert.Contains(t, err.Error(), "unknown column venue")
+
+	_, err = readScheduleCSV(strings.NewReader("id,season,start,status,homeId,homeName,awayId,awayName\n1,2019,tonight,Scheduled,1,Hawks,2,Celtics\n"))
+	assert.True(t, errors.Is(err, errInvalidScheduleFile))
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestBackfillGameDays(t *testing.T) {
+	defer cleanDatabase(t)
+	defer setDefaultMockClock()
+	defer setDefaultMockRapidAPIClient()
+
+	// the service was last run on the morning of the 17th, and is started up again on the 19th
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 19, 12, 0, 0, 0, time.UTC))
+
+	err := store.UpsertLeaderboard(leaderboard{ID: "2019", LastGameDayEvaluated: "2020-01-16"})
+	assert.Nil(t, err)
+
+	err = store.UpsertGameDayPicks(gameDayPicks{
+		UserID:    12345,
+		GameDayID: "2020-01-18",
+		SeasonID:  "2019",
+		Picks:     createPicks(),
+	})
+	assert.Nil(t, err)
+
+	// the 18th's games haven't all finished, so it stops after the 17th
+	evaluated, err := backfillGameDays()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, evaluated)
+
+	board, err := store.FindLeaderboardByID("2019")
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-01-17", board.LastGameDayEvaluated)
+
+	report, err := store.FindGameDayReportByID("2020-01-17")
+	assert.Nil(t, err)
+	assert.True(t, report.Evaluated)
+
+	rapidAPIClient = rapid.NewMockRapidClient(map[string]string{
+		"2020-01-18": "test/2020-01-18_nextday.json",
+		"2020-01-19": "test/2020-01-19_nextday.json",
+	})
+
+	evaluated, err = backfillGameDays()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, evaluated)
+
+	board, err = store.FindLeaderboardByID("2019")
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-01-18", board.LastGameDayEvaluated)
+	assert.Equal(t, int64(12345), board.Standings[0].UserID)
+
+	picks, err := store.FindPickReportsByGameDayID("2020-01-18")
+	assert.Nil(t, err)
+	assert.True(t, picks[0].Evaluated)
+
+	// and once caught up there's nothing left to do
+	evaluated, err = backfillGameDays()
+	assert.Nil(t, err)
+	assert.Zero(t, evaluated)
+}
+
+func TestImportSeasonDuringLateGames(t *testing.T) {
+	defer cleanDatabase(t)
+	defer setDefaultMockClock()
+
+	// past midnight, but the 18th's late games are still being played
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 19, 2, 0, 0, 0, time.UTC))
+
+	var progress []string
+	summary, err := importSeason("2020-01-17", "2020-01-18", func(p string) {
+		progress = append(progress, p)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2020-01-18"}, summary.ReportsCreated)
+	assert.Equal(t, 3, len(progress))
+	assert.Equal(t, "polled 3 of 3 dates, saved 24 games", progress[2])
+}
+
+func TestDailyCronPollsTodayOnce(t *testing.T) {
+	defer cleanDatabase(t)
+	defer setDefaultMockRapidAPIClient()
+
+	setLimitedRapidAPIClient(t, rapid.NewLimiter(rapid.Limits{}, apiUsageStore{}, clock))
+
+	// catching up on the 17th polls the 17th and the 18th, leaving only the 19th for tonight's late games
+	err := store.UpsertLeaderboard(leaderboard{ID: "2019", LastGameDayEvaluated: "2020-01-16"})
+	assert.Nil(t, err)
+
+	err = dailyCron()
+	assert.Nil(t, err)
+
+	usage, err := store.FindAPIUsage("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, usage.Requests)
+
+	// with nothing to catch up on, today is polled as well
+	err = dailyCron()
+	assert.Nil(t, err)
+
+	usage, err = store.FindAPIUsage("2020-01-18")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, usage.Requests)
+}
+
+func TestGetCurrentGameDay(t *testing.T) {
+	defer setupScheduleLocation()
+
+	config.Config.Schedule.Timezone = "America/New_York"
+	defer func() {
+		config.Config.Schedule.Timezone = ""
+	}()
+
+	err := setupScheduleLocation()
+	assert.Nil(t, err)
+
+	// 8:59am and 9am in New York
+	assert.Equal(t, "2020-01-17", getCurrentGameDay(time.Date(2020, time.January, 18, 13, 59, 0, 0, time.UTC)))
+	assert.Equal(t, "2020-01-18", getCurrentGameDay(time.Date(2020, time.January, 18, 14, 0, 0, 0, time.UTC)))
+
+	// still the 18th's game day for games finishing after midnight
+	assert.Equal(t, "2020-01-18", getCurrentGameDay(time.Date(2020, time.January, 19, 5, 0, 0, 0, time.UTC)))
+
+	config.Config.Schedule.Timezone = "Mars/Olympus_Mons"
+	assert.NotNil(t, setupScheduleLocation())
+}
+
+func TestRunJob(t *testing.T) {
+	defer cleanDatabase(t)
+
+	run := runJob(jobLive, pollCurrentGameDay)
+	assert.Equal(t, jobSucceeded, run.Status)
+
+	// nothing to poll for the 19th's game day
+	clock = clockPkg.NewMockClock(time.Date(2020, time.January, 20, 12, 0, 0, 0, time.UTC))
+	defer setDefaultMockClock()
+
+	run = runJob(jobRefresh, refreshGameDay)
+	assert.Equal(t, jobFailed, run.Status)
+	assert.Contains(t, run.Error, "no file found for date 2020-01-20")
+
+	runs, err := store.FindRecentJobRuns(10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(runs))
+	assert.Equal(t, jobRefresh, runs[0].Job)
+	assert.Equal(t, jobLive, runs[1].Job)
+
+	runs, err = store.FindRecentJobRuns(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(runs))
+}
+
+func TestRunScheduledJob(t *testing.T) {
+	defer cleanDatabase(t)
+
+	ran := 0
+	task := func() error {
+		ran++
+		return nil
+	}
+
+	runScheduledJob(jobLive, task)
+	assert.Equal(t, 1, ran)
+
+	// another instance can't run it until this one's lease has expired
+	instanceID = "other-instance"
+	defer func() {
+		instanceID = "test-instance"
+	}()
+
+	runScheduledJob(jobLive, task)
+	assert.Equal(t, 1, ran)
+
+	clock = clockPkg.NewMockClock(clock.Now().Add(defaultLeaseTTL))
+	defer setDefaultMockClock()
+
+	runScheduledJob(jobLive, task)
+	assert.Equal(t, 2, ran)
+
+	runs, err := store.FindRecentJobRuns(10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(runs))
+}
+
+func TestProvisionalPickStatus(t *testing.T) {
+	spread := -5.5
+	straight := gameDayReport{PickType: pickTypeStraight}
+	againstTheSpread := gameDayReport{PickType: pickTypeSpread}
+
+	game := func(state string, home int64, away int64) gameReport {
+		return gameReport{
+			HomeTeam: team{ID: 1, Score: home},
+			AwayTeam: team{ID: 2, Score: away},
+			State:    state,
+			Odds:     &odds{Spread: &spread},
+		}
+	}
+
+	tests := []struct {
+		report gameDayReport
+		game   gameReport
+		pick   int64
+		status string
+	}{
+		{straight, game(stateScheduled, 0, 0), 1, pickPending},
+		{straight, game(stateLive, 50, 50), 1, pickPending},
+		{straight, game(stateLive, 52, 50), 1, pickWinning},
+		{straight, game(stateLive, 52, 50), 2, pickLosing},
+		{straight, game(stateFinished, 101, 99), 1, pickCorrect},
+		{straight, game(stateFinished, 101, 99), 2, pickIncorrect},
+		{straight, game(statePostponed, 0, 0), 1, pickVoid},
+		{againstTheSpread, game(stateLive, 52, 50), 1, pickLosing},
+		{againstTheSpread, game(stateFinished, 101, 99), 2, pickCorrect},
+		{againstTheSpread, gameReport{State: stateFinished, HomeTeam: team{ID: 1, Score: 101}}, 1, pickVoid}, // no spread to go by
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.status, provisionalPickStatus(test.report, test.game, test.pick))
+	}
+}
+
+func TestEvaluateSurvivorPicksOutOfOrder(t *testing.T) {
+	defer cleanDatabase(t)
+
+	// went out on the 17th, but had already picked for the 18th
+	err := store.UpsertSurvivorEntry(survivorEntry{
+		ID:           survivorEntryID("2019", 1),
+		SeasonID:     "2019",
+		UserID:       1,
+		EliminatedOn: "2020-01-17",
+		Picks: map[string]survivorPick{
+			"2020-01-17": {GameID: 7001, TeamID: 4, Status: pickIncorrect},
+			"2020-01-18": {GameID: 7015, TeamID: 16, Status: pickPending},
+		},
+	})
+	assert.Nil(t, err)
+
+	// won on the 18th, which was evaluated before the 17th
+	err = store.UpsertSurvivorEntry(survivorEntry{
+		ID:       survivorEntryID("2019", 2),
+		SeasonID: "2019",
+		UserID:   2,
+		Picks: map[string]survivorPick{
+			"2020-01-17": {GameID: 7001, TeamID: 4, Status: pickPending},
+			"2020-01-18": {GameID: 7015, TeamID: 16, Status: pickCorrect},
+		},
+	})
+	assert.Nil(t, err)
+
+	err = evaluateSurvivorPicks(gameDayReport{ID: "2020-01-18", Games: map[int64]gameReport{7015: {WinnerID: 16}}}, "2019")
+	assert.Nil(t, err)
+
+	err = evaluateSurvivorPicks(gameDayReport{ID: "2020-01-17", Games: map[int64]gameReport{7001: {WinnerID: 21}}}, "2019")
+	assert.Nil(t, err)
+
+	entry, err := store.FindSurvivorEntry("2019", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, pickPending, entry.Picks["2020-01-18"].Status)
+
+	entry, err = store.FindSurvivorEntry("2019", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-01-17", entry.EliminatedOn)
+
+	standings, err := findSurvivorStandings("2019")
+	assert.Nil(t, err)
+	assert.Empty(t, standings.Alive)
+	assert.Len(t, standings.Eliminated, 2)
+
+	for _, status := range standings.Eliminated {
+		assert.Equal(t, 0, status.Survived)
+	}
+}
+
+func TestEvaluateSurvivorPicksAgain(t *testing.T) {
+	defer cleanDatabase(t)
+
+	err := store.UpsertSurvivorEntry(survivorEntry{
+		ID:       survivorEntryID("2019", 1),
+		SeasonID: "2019",
+		UserID:   1,
+		Picks: map[string]survivorPick{
+			"2020-01-17": {GameID: 7001, TeamID: 21, Status: pickCorrect},
+			"2020-01-18": {GameID: 7015, TeamID: 23, Status: pickPending},
+		},
+	})
+	assert.Nil(t, err)
+
+	err = evaluateSurvivorPicks(gameDayReport{ID: "2020-01-18", Games: map[int64]gameReport{7015: {WinnerID: 16}}}, "2019")
+	assert.Nil(t, err)
+
+	entry, err := store.FindSurvivorEntry("2019", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, pickIncorrect, entry.Picks["2020-01-18"].Status)
+	assert.Equal(t, "2020-01-18", entry.EliminatedOn)
+
+	// the result is corrected and the game day evaluated again
+	err = evaluateSurvivorPicks(gameDayReport{ID: "2020-01-18", Games: map[int64]gameReport{7015: {WinnerID: 23}}}, "2019")
+	assert.Nil(t, err)
+
+	entry, err = store.FindSurvivorEntry("2019", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, pickCorrect, entry.Picks["2020-01-18"].Status)
+	assert.Empty(t, entry.EliminatedOn)
+}
+
+func TestMergeSavedGamesFinishedPlayoffGame(t *testing.T) {
+	defer cleanDatabase(t)
+
+	playoffGame := func(id int64, state string) game {
+		return game{ID: id, SeasonID: "2019", SeasonStage: seasonStagePlayoffs, GameDayID: "2020-04-20", State: state}
+	}
+
+	err := store.UpsertMatches([]game{playoffGame(9000, stateFinished), playoffGame(9001, stateLive)})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name     string
+		games    []game
+		finished bool
+	}{
+		{"already finished", []game{playoffGame(9000, stateFinished)}, false},
+		{"still playing", []game{playoffGame(9001, stateLive)}, false},
+		{"just finished", []game{playoffGame(9001, stateFinished)}, true},
+		{"never saved", []game{playoffGame(9002, stateFinished)}, true},
+		{"regular season", []game{{ID: 9001, GameDayID: "2020-04-20", State: stateFinished}}, false},
+	}
+
+	for _, test := range tests {
+		_, finished, err := mergeSavedGames(test.games)
+		assert.Nil(t, err)
+		assert.Equal(t, test.finished, finished, test.name)
+	}
 }
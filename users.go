@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nba-pick-and-play/config"
+	"nba-pick-and-play/pkg/auth"
+	"nba-pick-and-play/pkg/response"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type (
+	contextKey string
+
+	tokenPair struct {
+		AccessToken           string    `json:"accessToken"`
+		AccessTokenExpiresAt  time.Time `json:"accessTokenExpiresAt"`
+		RefreshToken          string    `json:"refreshToken"`
+		RefreshTokenExpiresAt time.Time `json:"refreshTokenExpiresAt"`
+		User                  *user     `json:"user"`
+	}
+)
+
+const (
+	userContextKey contextKey = "user"
+
+	roleUser  = "user"
+	roleAdmin = "admin"
+
+	adminPasswordEnv  = "NBA_ADMIN_PASSWORD"
+	minPasswordLength = 8 // as in credentialsPayload
+)
+
+var (
+	errUsernameTaken      = errors.New("username is already taken")
+	errInvalidCredentials = errors.New("invalid username or password")
+	errUnknownUser        = errors.New("token belongs to an unknown user")
+	errReservedUsername   = errors.New("username is reserved for an admin")
+)
+
+// creates a new user, storing only the bcrypt hash of their password
+func registerUser(username string, password string) (*user, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return nil, err
+	}
+
+	newUser := user{
+		Username:     normaliseUsername(username),
+		PasswordHash: string(hash),
+		Role:         roleForUsername(normaliseUsername(username)),
+		CreatedAt:    clock.Now(),
+	}
+
+	return store.InsertUser(newUser)
+}
+
+// registers a user through the api, where the admins' usernames can't be taken as they'd come with the admin role
+func signUpUser(username string, password string) (*user, error) {
+	if roleForUsername(normaliseUsername(username)) == roleAdmin {
+		return nil, errReservedUsername
+	}
+
+	return registerUser(username, password)
+}
+
+// for the -create-admin flag, the password being taken from the environment so it isn't left in the shell history
+func runCreateAdmin(username string) {
+	if roleForUsername(normaliseUsername(username)) != roleAdmin {
+		log.Fatalf("%s is not one of the admins in the config", username)
+	}
+
+	password := os.Getenv(adminPasswordEnv)
+
+	if len(password) < minPasswordLength {
+		log.Fatalf("%s must be set to a password of at least %d characters", adminPasswordEnv, minPasswordLength)
+	}
+
+	admin, err := registerUser(username, password)
+
+	if err != nil {
+		log.Fatalf("couldn't create admin %s: %s", username, err.Error())
+	}
+
+	log.Printf("Created admin %s with id %d", admin.Username, admin.ID)
+}
+
+// checks a username/password combination, returning the matching user
+func authenticateUser(username string, password string) (*user, error) {
+	user, err := store.FindUserByUsername(normaliseUsername(username))
+
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, errInvalidCredentials
+		}
+
+		return nil, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+
+	if err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	user.Role = roleForUsername(user.Username)
+	return user, nil
+}
+
+// maps user ids to their usernames so results and leaderboards are readable
+func usernamesByID(ids []int64) (map[int64]string, error) {
+	usernames := make(map[int64]string)
+
+	if len(ids) == 0 {
+		return usernames, nil
+	}
+
+	users, err := store.FindUsersByIDs(ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	return usernames, nil
+}
+
+// admins are configured by username rather than promoted through the api
+func roleForUsername(username string) string {
+	for _, admin := range config.Config.Auth.Admins {
+		if normaliseUsername(admin) == username {
+			return roleAdmin
+		}
+	}
+
+	return roleUser
+}
+
+func normaliseUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// issues a fresh access and refresh token for the user
+func issueTokens(user *user) (*tokenPair, error) {
+	now := clock.Now()
+
+	accessToken, accessExpiry, err := tokenSigner.Issue(user.ID, auth.AccessToken, now, config.Config.Auth.AccessTokenTTL.Duration)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshExpiry, err := tokenSigner.Issue(user.ID, auth.RefreshToken, now, config.Config.Auth.RefreshTokenTTL.Duration)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExpiry,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiry,
+		User:                  user,
+	}, nil
+}
+
+// exchanges a valid refresh token for a new pair of tokens
+func refreshTokens(refreshToken string) (*tokenPair, error) {
+	user, err := userFromToken(refreshToken, auth.RefreshToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return issueTokens(user)
+}
+
+// verifies the token and loads the user it was issued to
+func userFromToken(token string, tokenType string) (*user, error) {
+	claims, err := tokenSigner.Verify(token, tokenType, clock.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := store.FindUserByID(claims.UserID)
+
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, errUnknownUser
+		}
+
+		return nil, err
+	}
+
+	// the admins in the config can change after sign up, so the saved role isn't relied on
+	user.Role = roleForUsername(user.Username)
+	return user, nil
+}
+
+// middleware which resolves the caller from the bearer token in the Authorization header
+func requireUser(next http.Handler) http.Handler {
+	return authenticate(next, false)
+}
+
+// as requireUser, but also takes the token from ?token= as a browser's EventSource can't set headers
+func requireStreamUser(next http.Handler) http.Handler {
+	return authenticate(next, true)
+}
+
+func authenticate(next http.Handler, allowQueryToken bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if token == "" && allowQueryToken {
+			token = r.URL.Query().Get("token")
+		}
+
+		if token == "" {
+			response.ReturnError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		user, err := userFromToken(token, auth.AccessToken)
+
+		if err != nil {
+			if isAuthError(err) {
+				response.ReturnError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			log.Error(err.Error())
+			response.ReturnError(w, http.StatusInternalServerError, genericError)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithUser(r.Context(), user)))
+	})
+}
+
+// middleware which only lets through callers with the given role, must be used after requireUser
+func requireRole(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := userFromContext(r.Context())
+
+			if user == nil || user.Role != role {
+				response.ReturnError(w, http.StatusForbidden, fmt.Sprintf("requires the %s role", role))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// whether the error was caused by the caller's credentials rather than the service
+func isAuthError(err error) bool {
+	return errors.Is(err, errInvalidCredentials) ||
+		errors.Is(err, errUnknownUser) ||
+		errors.Is(err, auth.ErrMalformedToken) ||
+		errors.Is(err, auth.ErrInvalidSignature) ||
+		errors.Is(err, auth.ErrWrongTokenType) ||
+		errors.Is(err, auth.ErrExpiredToken)
+}
+
+func contextWithUser(ctx context.Context, user *user) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+func userFromContext(ctx context.Context) *user {
+	user, _ := ctx.Value(userContextKey).(*user)
+	return user
+}
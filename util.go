@@ -1,12 +1,28 @@
 package main
 
-import "time"
+import (
+	"fmt"
+	"nba-pick-and-play/config"
+	"time"
+)
 
+// the game day as of the time, which rolls over at the configured hour in the schedule's timezone
 func getCurrentGameDay(date time.Time) string {
-	// game day rolls over at 9am
-	if date.Hour() < 9 {
+	date = inScheduleLocation(date)
+
+	if date.Hour() < config.Config.Schedule.RolloverHour {
 		return date.Add(-24 * time.Hour).Format(basicDateFormat)
 	}
 
 	return date.Format(basicDateFormat)
 }
+
+func validateDates(dates ...string) error {
+	for _, date := range dates {
+		if _, err := time.Parse(basicDateFormat, date); err != nil {
+			return fmt.Errorf("date %s is not in the format YYYY-MM-DD", date)
+		}
+	}
+
+	return nil
+}